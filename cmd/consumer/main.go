@@ -1,12 +1,20 @@
 package main
 
 import (
-	"fmt"
+	"cmp"
+	"context"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/vfcoelho/go-project-pocs/internal"
+	errs "github.com/vfcoelho/go-project-pocs/internal/errors"
 	"github.com/vfcoelho/go-project-pocs/internal/events"
 	"github.com/vfcoelho/go-project-pocs/src/dtos"
 	"github.com/vfcoelho/go-project-pocs/src/handlers"
@@ -14,25 +22,61 @@ import (
 )
 
 func main() {
-	consumer := events.NewConsumer[dtos.Record]()
-
-	handlers := []events.Handler{events.ErrorRecover, events.ParseMessage[dtos.Record], processMessage} //REVIEW: decorator stack of handlers similar to the middleware pattern
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	slog.SetDefault(logger)
 
+	metrics := errs.NewMetrics()
 	go func() {
-		if err := consumer.Consume(handlers...); err != nil {
+		if err := http.ListenAndServe(cmp.Or(os.Getenv("METRICS_ADDR"), "127.0.0.1:9090"), metrics); err != nil { //REVIEW: the consumer has no http server of its own, the error metrics get a dedicated one, only listening on loopback unless configured otherwise
 			log.Panic(err)
 		}
 	}()
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	deadLetters, err := events.NewFileDeadLetterStore(cmp.Or(os.Getenv("DEADLETTERS_DIR"), "deadletters"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	concurrency, _ := strconv.Atoi(os.Getenv("CONCURRENCY"))
+	var consumerOptions []events.ConsumerOption
+	if dir := os.Getenv("EVENTS_DIR"); dir != "" { //REVIEW: shared with the api, which appends the events
+		transport, err := events.OpenFileTransport(dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		consumerOptions = append(consumerOptions, events.WithConsumerTransport(transport))
+	} else {
+		transport, err := events.ExposeNetchan(events.DefaultNetchanID, events.WithInboxDir(cmp.Or(os.Getenv("INBOX_DIR"), "inbox"))) //REVIEW: the api gets its events confirmed once they are on disk, so they are not lost when the consumer stops
+		if err != nil {
+			log.Fatal(err)
+		}
+		consumerOptions = append(consumerOptions, events.WithConsumerTransport(transport))
+	}
+	consumer, err := events.NewConsumer(append(consumerOptions,
+		events.WithDeadLetters(deadLetters),
+		events.WithConcurrency(max(concurrency, 1)),
+		events.WithOrderingKey(func(record dtos.Record) string { //REVIEW: events of the same record are processed in order, events without record id are not ordered
+			return lo.Ternary(record.Id != uuid.Nil, record.Id.String(), "")
+		}),
+	)...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	router := events.Route[dtos.Record](events.NewRouter(), dtos.RecordCreatedEventType, events.Retry(), processMessage) //REVIEW: other events are registered on the same router, unknown ones are dead-lettered
+
+	handlers := []events.Handler{events.ErrorRecover, events.SetErrorRegistry(internal.REGISTRY), events.SetLogger(logger), events.SetErrorObserver(metrics), router.Dispatch} //REVIEW: decorator stack of handlers similar to the middleware pattern
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	<-c
-	fmt.Println("Running cleanup tasks...")
+	if err := consumer.Consume(ctx, handlers...); err != nil { //REVIEW: returns once the messages being processed when the signal arrived are settled
+		log.Panic(err)
+	}
+	logger.Info("running cleanup tasks")
 
 	consumer.Close()
 
-	fmt.Println("Fiber was successful shutdown.")
+	logger.Info("successfully shutdown")
 }
 
 func processMessage(ctx *events.ConsumerCtx) error {
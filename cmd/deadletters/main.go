@@ -0,0 +1,103 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vfcoelho/go-project-pocs/internal/events"
+)
+
+var ErrUsage = errors.New("usage: deadletters [-dir dir] [-uri uri] [-events dir] list | show <id> | redrive <id>... | redrive -all")
+
+type Options struct {
+	Dir       string
+	URI       string
+	EventsDir string                           // log directory of the main queue, used instead of URI when set
+	Transport func() (events.Transport, error) // transport of the re-driven letters, the netchan bound to URI when nil
+}
+
+func main() {
+	options := Options{}
+	flag.StringVar(&options.Dir, "dir", cmp.Or(os.Getenv("DEADLETTERS_DIR"), "deadletters"), "directory of the dead letter store")
+	flag.StringVar(&options.URI, "uri", events.DefaultNetchanURI, "netchan uri of the main queue, used to re-drive letters")
+	flag.StringVar(&options.EventsDir, "events", os.Getenv("EVENTS_DIR"), "log directory of the main queue, used to re-drive letters instead of the netchan uri")
+	flag.Parse()
+
+	if err := Run(options, flag.Args(), os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func Run(options Options, args []string, stdout io.Writer) error { //REVIEW: letters are printed as json so they can be piped to other tools
+	if len(args) == 0 {
+		return ErrUsage
+	}
+	store, err := events.NewFileDeadLetterStore(options.Dir)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+
+	switch command, args := args[0], args[1:]; {
+	case command == "list" && len(args) == 0:
+		letters, err := store.List()
+		if err != nil {
+			return err
+		}
+		return encoder.Encode(letters)
+	case command == "show" && len(args) == 1:
+		letter, err := store.Get(args[0])
+		if err != nil {
+			return err
+		}
+		return encoder.Encode(letter)
+	case command == "redrive" && len(args) > 0:
+		return redrive(options, store, args, stdout)
+	default:
+		return ErrUsage
+	}
+}
+
+func redrive(options Options, store events.DeadLetterStore, ids []string, stdout io.Writer) error {
+	if len(ids) == 1 && ids[0] == "-all" {
+		letters, err := store.List()
+		if err != nil {
+			return err
+		}
+		ids = ids[:0]
+		for _, letter := range letters {
+			ids = append(ids, letter.ID)
+		}
+	}
+	newTransport := options.Transport
+	if newTransport == nil {
+		newTransport = func() (events.Transport, error) {
+			if options.EventsDir != "" {
+				return events.OpenFileTransport(options.EventsDir)
+			}
+			return events.BindNetchan(options.URI)
+		}
+	}
+	transport, err := newTransport()
+	if err != nil {
+		return err
+	}
+	defer transport.Close()
+
+	var errs []error
+	for _, id := range ids {
+		if err := events.Redrive(store, transport, id); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Fprintf(stdout, "re-driven %s\n", id)
+	}
+	return errors.Join(errs...)
+}
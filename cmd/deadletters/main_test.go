@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/vfcoelho/go-project-pocs/internal/events"
+)
+
+type DeadLettersTestSuite struct {
+	suite.Suite
+}
+
+func TestDeadLettersTestSuite(t *testing.T) {
+	suite.Run(t, new(DeadLettersTestSuite))
+}
+
+type unclosableTransport struct { // keeps the test transport open across runs
+	events.Transport
+}
+
+func (unclosableTransport) Close() error {
+	return nil
+}
+
+func (suite *DeadLettersTestSuite) TestRun() {
+
+	setup := func() (Options, *events.ChannelTransport, []events.DeadLetter) {
+		transport := events.NewChannelTransport(0)
+		options := Options{Dir: suite.T().TempDir(), Transport: func() (events.Transport, error) { return unclosableTransport{transport}, nil }}
+		store, _ := events.NewFileDeadLetterStore(options.Dir)
+		var letters []events.DeadLetter
+		for _, payload := range []string{`{"id": "1"}`, `{"id": "2"}`} {
+			letter := events.NewDeadLetter(&events.Delivery{Message: []byte(payload), Attempt: 1}, "handler", 3, errors.New("failed"))
+			_ = store.Add(letter)
+			letters = append(letters, letter)
+		}
+		return options, transport, letters
+	}
+
+	suite.Run("lists and shows letters", func() {
+		options, _, letters := setup()
+		var stdout bytes.Buffer
+		assert.NoError(suite.T(), Run(options, []string{"list"}, &stdout))
+		var listed []events.DeadLetter
+		_ = json.Unmarshal(stdout.Bytes(), &listed)
+		assert.Len(suite.T(), listed, 2)
+
+		stdout.Reset()
+		assert.NoError(suite.T(), Run(options, []string{"show", letters[1].ID}, &stdout))
+		var shown events.DeadLetter
+		_ = json.Unmarshal(stdout.Bytes(), &shown)
+		assert.Equal(suite.T(), []byte(`{"id": "2"}`), shown.Payload)
+		assert.Equal(suite.T(), 3, shown.Attempts)
+	})
+	suite.Run("re-drives letters to the main queue", func() {
+		options, transport, letters := setup()
+		var stdout bytes.Buffer
+		assert.NoError(suite.T(), Run(options, []string{"redrive", letters[0].ID}, &stdout))
+		delivery, _ := transport.Receive(context.Background())
+		assert.Equal(suite.T(), []byte(`{"id": "1"}`), delivery.Message)
+
+		assert.ErrorIs(suite.T(), Run(options, []string{"redrive", letters[0].ID}, &stdout), events.ErrDeadLetterNotFound)
+		assert.NoError(suite.T(), Run(options, []string{"redrive", "-all"}, &stdout))
+		delivery, _ = transport.Receive(context.Background())
+		assert.Equal(suite.T(), []byte(`{"id": "2"}`), delivery.Message)
+	})
+	suite.Run("re-drives letters to the log directory of the main queue", func() {
+		options, _, letters := setup()
+		options.Transport, options.EventsDir = nil, suite.T().TempDir()
+		assert.NoError(suite.T(), Run(options, []string{"redrive", letters[0].ID}, &bytes.Buffer{}))
+
+		transport, err := events.OpenFileTransport(options.EventsDir)
+		suite.Require().NoError(err)
+		defer transport.Close()
+		delivery, _ := transport.Receive(context.Background())
+		assert.Equal(suite.T(), []byte(`{"id": "1"}`), delivery.Message)
+	})
+	suite.Run("rejects unknown commands", func() {
+		options, _, _ := setup()
+		assert.ErrorIs(suite.T(), Run(options, nil, &bytes.Buffer{}), ErrUsage)
+		assert.ErrorIs(suite.T(), Run(options, []string{"show"}, &bytes.Buffer{}), ErrUsage)
+	})
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	codePattern       = regexp.MustCompile(`^[a-z0-9_]+(\.[a-z0-9_]+)*$`)
+	redactPattern     = regexp.MustCompile(`^(true|mask|(response|log)=(true|false|mask)(,(response|log)=(true|false|mask))?)$`)
+	severities        = map[string]bool{"": true, "info": true, "warning": true, "error": true, "critical": true}
+	classes           = map[string]bool{"": true, "transient": true, "permanent": true, "throttled": true, "conflict": true}
+	fieldTypes        = map[string]fieldType{ //REVIEW: supported data field types and their go and json schema representations
+		"string":   {goType: "string", schema: map[string]any{"type": "string"}},
+		"integer":  {goType: "int", schema: map[string]any{"type": "integer"}},
+		"number":   {goType: "float64", schema: map[string]any{"type": "number"}},
+		"boolean":  {goType: "bool", schema: map[string]any{"type": "boolean"}},
+		"uuid":     {goType: "uuid.UUID", goImport: "github.com/google/uuid", schema: map[string]any{"type": "string", "format": "uuid"}},
+		"datetime": {goType: "time.Time", goImport: "time", schema: map[string]any{"type": "string", "format": "date-time"}},
+	}
+)
+
+var grpcCodes = func() map[string]codes.Code { //REVIEW: grpc codes by their go constant names, OK is not an error code
+	result := make(map[string]codes.Code)
+	for code := codes.Canceled; code <= codes.Unauthenticated; code++ {
+		result[code.String()] = code
+	}
+	return result
+}()
+
+type fieldType struct {
+	goType   string
+	goImport string
+	schema   map[string]any
+}
+
+type Catalog struct { //REVIEW: error catalog source file, every code is declared once and every artifact is generated from it
+	Package string `yaml:"package" json:"package"`
+	Codes   []Code `yaml:"codes" json:"codes"`
+}
+
+type Code struct {
+	Name        string   `yaml:"name" json:"name"` // go constant name
+	Code        string   `yaml:"code" json:"code"`
+	Aliases     []string `yaml:"aliases,omitempty" json:"aliases,omitempty"` // former codes, still accepted when decoding errors
+	Status      int      `yaml:"status,omitempty" json:"status,omitempty"`
+	GRPCCode    string   `yaml:"grpc_code,omitempty" json:"grpc_code,omitempty"` // grpc code name, e.g. NotFound
+	Retryable   bool     `yaml:"retryable,omitempty" json:"retryable,omitempty"`
+	Class       string   `yaml:"class,omitempty" json:"class,omitempty"`
+	RetryAfter  string   `yaml:"retry_after,omitempty" json:"retry_after,omitempty"` // go duration, e.g. 5s
+	Severity    string   `yaml:"severity,omitempty" json:"severity,omitempty"`
+	Message     string   `yaml:"message,omitempty" json:"message,omitempty"`
+	Description string   `yaml:"description,omitempty" json:"description,omitempty"`
+	Data        *Data    `yaml:"data,omitempty" json:"data,omitempty"`
+}
+
+type Data struct {
+	Name        string  `yaml:"name" json:"name"` // go type name
+	Description string  `yaml:"description,omitempty" json:"description,omitempty"`
+	Fields      []Field `yaml:"fields" json:"fields"`
+}
+
+type Field struct {
+	Name        string `yaml:"name" json:"name"` // json field name
+	GoName      string `yaml:"go_name,omitempty" json:"go_name,omitempty"`
+	Type        string `yaml:"type" json:"type"`
+	Required    bool   `yaml:"required,omitempty" json:"required,omitempty"`
+	Redact      string `yaml:"redact,omitempty" json:"redact,omitempty"` // redact struct tag, e.g. true, mask or response=true,log=mask
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+func LoadCatalog(path string) (catalog Catalog, err error) { //REVIEW: catalogs can be written either in yaml or json
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(content, &catalog)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &catalog)
+	default:
+		err = fmt.Errorf("unsupported catalog format: %s", path)
+	}
+	if err != nil {
+		return
+	}
+	return catalog, catalog.Validate()
+}
+
+func (c Catalog) Validate() error {
+	var errs []error
+	if !identifierPattern.MatchString(c.Package) {
+		errs = append(errs, fmt.Errorf("invalid package name: %q", c.Package))
+	}
+	names := make(map[string]bool)
+	codes := make(map[string]bool)
+	for _, code := range c.Codes {
+		if !identifierPattern.MatchString(code.Name) || names[code.Name] {
+			errs = append(errs, fmt.Errorf("invalid or duplicated name: %q", code.Name))
+		}
+		names[code.Name] = true
+		if !codePattern.MatchString(code.Code) || codes[code.Code] {
+			errs = append(errs, fmt.Errorf("invalid or duplicated code: %q", code.Code))
+		}
+		codes[code.Code] = true
+		for _, alias := range code.Aliases {
+			if !codePattern.MatchString(alias) || codes[alias] {
+				errs = append(errs, fmt.Errorf("invalid or duplicated alias for %s: %q", code.Code, alias))
+			}
+			codes[alias] = true
+		}
+		if code.Status != 0 && (code.Status < 100 || code.Status > 599) {
+			errs = append(errs, fmt.Errorf("invalid status for %s: %d", code.Code, code.Status))
+		}
+		if _, ok := grpcCodes[code.GRPCCode]; code.GRPCCode != "" && !ok {
+			errs = append(errs, fmt.Errorf("invalid grpc code for %s: %q", code.Code, code.GRPCCode))
+		}
+		if !severities[code.Severity] {
+			errs = append(errs, fmt.Errorf("invalid severity for %s: %q", code.Code, code.Severity))
+		}
+		if !classes[code.Class] {
+			errs = append(errs, fmt.Errorf("invalid class for %s: %q", code.Code, code.Class))
+		}
+		if _, err := code.RetryAfterDuration(); err != nil {
+			errs = append(errs, fmt.Errorf("invalid retry after for %s: %w", code.Code, err))
+		}
+		if code.Data == nil {
+			continue
+		}
+		if !identifierPattern.MatchString(code.Data.Name) || names[code.Data.Name] {
+			errs = append(errs, fmt.Errorf("invalid or duplicated data name for %s: %q", code.Code, code.Data.Name))
+		}
+		names[code.Data.Name] = true
+		fields := make(map[string]bool)
+		for _, field := range code.Data.Fields {
+			if field.Name == "" || fields[field.Name] {
+				errs = append(errs, fmt.Errorf("invalid or duplicated data field for %s: %q", code.Code, field.Name))
+			}
+			fields[field.Name] = true
+			if _, ok := fieldTypes[field.Type]; !ok {
+				errs = append(errs, fmt.Errorf("unsupported type for %s field %s: %q", code.Code, field.Name, field.Type))
+			}
+			if field.Redact != "" && !redactPattern.MatchString(field.Redact) {
+				errs = append(errs, fmt.Errorf("invalid redact for %s field %s: %q", code.Code, field.Name, field.Redact))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c Code) RetryAfterDuration() (time.Duration, error) {
+	if c.RetryAfter == "" {
+		return 0, nil
+	}
+	delay, err := time.ParseDuration(c.RetryAfter)
+	if err == nil && delay <= 0 {
+		err = fmt.Errorf("non positive duration %s", c.RetryAfter)
+	}
+	return delay, err
+}
+
+func (f Field) Identifier() string { //REVIEW: go field name, derived from the json name unless explicitly declared
+	if f.GoName != "" {
+		return f.GoName
+	}
+	var identifier strings.Builder
+	for _, part := range strings.FieldsFunc(f.Name, func(r rune) bool { return r == '_' || r == '-' }) {
+		switch upper := strings.ToUpper(part); upper {
+		case "ID", "URL", "URI", "HTTP", "JSON", "UUID":
+			identifier.WriteString(upper)
+		default:
+			identifier.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return identifier.String()
+}
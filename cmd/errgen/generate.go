@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+const generatedHeader = "Code generated by errgen. DO NOT EDIT."
+
+var severityConstants = map[string]string{
+	"info":     "errors.SeverityInfo",
+	"warning":  "errors.SeverityWarning",
+	"error":    "errors.SeverityError",
+	"critical": "errors.SeverityCritical",
+}
+
+var classConstants = map[string]string{
+	"transient": "errors.ClassTransient",
+	"permanent": "errors.ClassPermanent",
+	"throttled": "errors.ClassThrottled",
+	"conflict":  "errors.ClassConflict",
+}
+
+var goTemplate = template.Must(template.New("go").Funcs(template.FuncMap{
+	"goType":     func(field Field) string { return fieldTypes[field.Type].goType },
+	"severity":   func(severity string) string { return severityConstants[severity] },
+	"class":      func(class string) string { return classConstants[class] },
+	"retryAfter": retryAfterExpression,
+	"comment":    func(text string) string { return strings.Join(strings.Fields(text), " ") },
+}).Parse(`// {{.Header}}
+
+package {{.Catalog.Package}}
+
+import (
+{{- range .StandardImports}}
+	"{{.}}"
+{{- end}}
+{{if .StandardImports}}
+{{end}}
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+)
+
+const (
+{{- range .Catalog.Codes}}
+	{{.Name}} errors.ErrorCode = "{{.Code}}"{{if .Description}} // {{comment .Description}}{{end}}
+{{- end}}
+)
+{{range .Catalog.Codes}}{{if .Data}}
+{{if .Data.Description}}// {{comment .Data.Description}}
+{{end}}type {{.Data.Name}} struct {
+{{- range .Data.Fields}}
+	{{.Identifier}} {{goType .}} ` + "`" + `json:"{{.Name}}{{if not .Required}},omitempty{{end}}"{{if .Redact}} redact:"{{.Redact}}"{{end}}` + "`" + `{{if .Description}} // {{comment .Description}}{{end}}
+{{- end}}
+}
+{{end}}{{end}}
+var REGISTRY = errors.DefaultRegistry.MustRegister(
+{{- range .Catalog.Codes}}
+	errors.CodeDefinition{
+		Code: {{.Name}},
+		{{- if .Status}}
+		HTTPStatus: {{.Status}},
+		{{- end}}
+		{{- if .Retryable}}
+		Retryable: true,
+		{{- end}}
+		{{- if .Class}}
+		Class: {{class .Class}},
+		{{- end}}
+		{{- if .RetryAfter}}
+		RetryAfter: {{retryAfter .}},
+		{{- end}}
+		{{- if .Severity}}
+		Severity: {{severity .Severity}},
+		{{- end}}
+		{{- if .Message}}
+		Message: {{printf "%q" .Message}},
+		{{- end}}
+		{{- if .Data}}
+		DataType: reflect.TypeFor[{{.Data.Name}}](),
+		{{- end}}
+		{{- if .Aliases}}
+		Aliases: []errors.ErrorCode{ {{- range $i, $alias := .Aliases}}{{if $i}}, {{end}}{{printf "%q" $alias}}{{end -}} },
+		{{- end}}
+	},
+{{- end}}
+)
+{{if .GRPCCodes}}
+// grpc codes of the error codes, children codes use the code of their nearest mapped ancestor.
+var GRPC_CODES = map[errors.ErrorCode]codes.Code{
+{{- range .Catalog.Codes}}{{if .GRPCCode}}
+	{{.Name}}: codes.{{.GRPCCode}},
+{{- end}}{{end}}
+}
+{{end}}`))
+
+func GenerateGo(catalog Catalog, errorsImport string) ([]byte, error) { //REVIEW: error code constants, data types and their registration
+	imports := []string{errorsImport}
+	grpcCodes := false
+	for _, code := range catalog.Codes {
+		if code.RetryAfter != "" {
+			imports = append(imports, "time")
+		}
+		if code.GRPCCode != "" {
+			imports = append(imports, "google.golang.org/grpc/codes")
+			grpcCodes = true
+		}
+		if code.Data == nil {
+			continue
+		}
+		imports = append(imports, "reflect")
+		for _, field := range code.Data.Fields {
+			if goImport := fieldTypes[field.Type].goImport; goImport != "" {
+				imports = append(imports, goImport)
+			}
+		}
+	}
+	imports = lo.Uniq(imports)
+	sort.Strings(imports)
+	standardImports, imports := lo.Filter(imports, isStandardImport), lo.Reject(imports, isStandardImport) //REVIEW: standard library imports are grouped first, as goimports does
+
+	var buffer bytes.Buffer
+	err := goTemplate.Execute(&buffer, map[string]any{
+		"Header":          generatedHeader,
+		"Catalog":         catalog,
+		"StandardImports": standardImports,
+		"Imports":         imports,
+		"GRPCCodes":       grpcCodes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buffer.Bytes())
+}
+
+func GenerateMarkdown(catalog Catalog) []byte { //REVIEW: human readable documentation of every error code
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "<!-- %s -->\n\n# Error codes\n\n", generatedHeader)
+	buffer.WriteString("| Code | HTTP status | gRPC code | Class | Retryable | Retry after | Severity | Message |\n")
+	buffer.WriteString("| --- | --- | --- | --- | --- | --- | --- | --- |\n")
+	for _, code := range catalog.Codes {
+		fmt.Fprintf(&buffer, "| [`%s`](#%s) | %s | %s | %s | %s | %s | %s | %s |\n",
+			code.Code,
+			anchor(code.Code),
+			lo.Ternary(code.Status != 0, fmt.Sprint(code.Status), "inherited"),
+			lo.Ternary(code.GRPCCode != "", code.GRPCCode, "inherited"),
+			lo.Ternary(code.Class != "", code.Class, "-"),
+			lo.Ternary(code.Retryable || code.Class == "transient" || code.Class == "throttled", "yes", "no"),
+			lo.Ternary(code.RetryAfter != "", code.RetryAfter, "-"),
+			lo.Ternary(code.Severity != "", code.Severity, "error"),
+			code.Message,
+		)
+	}
+	for _, code := range catalog.Codes {
+		fmt.Fprintf(&buffer, "\n## `%s`\n\n", code.Code)
+		if code.Description != "" {
+			fmt.Fprintf(&buffer, "%s\n\n", strings.TrimSpace(code.Description))
+		}
+		fmt.Fprintf(&buffer, "Go constant: `%s`\n", code.Name)
+		if len(code.Aliases) > 0 { //REVIEW: renamed codes are a breaking change for callers matching on them, responses only carry the current code
+			fmt.Fprintf(&buffer, "\nFormerly `%s`, still accepted when decoding errors but no longer sent in responses.\n", strings.Join(code.Aliases, "`, `"))
+		}
+		if code.Data == nil {
+			continue
+		}
+		fmt.Fprintf(&buffer, "\nData (`%s`, schema [`schemas/%s`](schemas/%s)):\n\n", code.Data.Name, schemaFile(code), schemaFile(code))
+		buffer.WriteString("| Field | Type | Required | Description |\n")
+		buffer.WriteString("| --- | --- | --- | --- |\n")
+		for _, field := range code.Data.Fields {
+			fmt.Fprintf(&buffer, "| `%s` | %s | %s | %s |\n", field.Name, field.Type, lo.Ternary(field.Required, "yes", "no"), field.Description)
+		}
+	}
+	return buffer.Bytes()
+}
+
+func GenerateSchemas(catalog Catalog) (map[string][]byte, error) { //REVIEW: json schema of the data carried by each error code
+	schemas := make(map[string][]byte)
+	for _, code := range catalog.Codes {
+		if code.Data == nil {
+			continue
+		}
+		properties := make(map[string]any, len(code.Data.Fields))
+		required := make([]string, 0, len(code.Data.Fields))
+		for _, field := range code.Data.Fields {
+			property := make(map[string]any)
+			for key, value := range fieldTypes[field.Type].schema {
+				property[key] = value
+			}
+			if field.Description != "" {
+				property["description"] = field.Description
+			}
+			properties[field.Name] = property
+			if field.Required {
+				required = append(required, field.Name)
+			}
+		}
+		schema := map[string]any{
+			"$schema":              "https://json-schema.org/draft/2020-12/schema",
+			"$comment":             generatedHeader,
+			"title":                code.Data.Name,
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		if code.Data.Description != "" {
+			schema["description"] = code.Data.Description
+		}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		content, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		schemas[schemaFile(code)] = append(content, '\n')
+	}
+	return schemas, nil
+}
+
+func retryAfterExpression(code Code) string { //REVIEW: durations are written as readable go expressions
+	delay, _ := code.RetryAfterDuration()
+	if delay%time.Second == 0 {
+		return fmt.Sprintf("%d * time.Second", delay/time.Second)
+	}
+	return fmt.Sprintf("%d * time.Millisecond", delay/time.Millisecond)
+}
+
+func isStandardImport(path string, _ int) bool {
+	return !strings.Contains(strings.Split(path, "/")[0], ".")
+}
+
+func schemaFile(code Code) string {
+	return code.Code + ".schema.json"
+}
+
+func anchor(code string) string { //REVIEW: github style heading anchor of a code section
+	return strings.ReplaceAll(code, ".", "")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var ErrStale = errors.New("generated files are stale")
+
+type Options struct {
+	Catalog      string
+	GoOutput     string
+	DocsOutput   string
+	SchemaOutput string
+	ErrorsImport string
+	Check        bool
+}
+
+func main() {
+	options := Options{}
+	flag.StringVar(&options.Catalog, "catalog", "errors.yaml", "error catalog file, yaml or json")
+	flag.StringVar(&options.GoOutput, "go", "mapping_gen.go", "generated go file with codes, data types and their registration")
+	flag.StringVar(&options.DocsOutput, "docs", "", "generated markdown documentation, skipped when empty")
+	flag.StringVar(&options.SchemaOutput, "schemas", "", "directory of the generated data json schemas, skipped when empty")
+	flag.StringVar(&options.ErrorsImport, "errors-import", "github.com/vfcoelho/go-project-pocs/internal/errors", "import path of the errors package")
+	flag.BoolVar(&options.Check, "check", false, "fails if the generated files are stale instead of writing them")
+	flag.Parse()
+
+	if err := Run(options); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func Run(options Options) error {
+	files, err := Generate(options)
+	if err != nil {
+		return err
+	}
+	if options.Check {
+		return Check(files, options)
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Generate(options Options) (map[string][]byte, error) { //REVIEW: every generated file by its path, so writing and checking share the same output
+	catalog, err := LoadCatalog(options.Catalog)
+	if err != nil {
+		return nil, fmt.Errorf("error loading catalog %s: %w", options.Catalog, err)
+	}
+
+	files := make(map[string][]byte)
+	if files[options.GoOutput], err = GenerateGo(catalog, options.ErrorsImport); err != nil {
+		return nil, fmt.Errorf("error generating go code: %w", err)
+	}
+	if options.DocsOutput != "" {
+		files[options.DocsOutput] = GenerateMarkdown(catalog)
+	}
+	if options.SchemaOutput != "" {
+		schemas, err := GenerateSchemas(catalog)
+		if err != nil {
+			return nil, fmt.Errorf("error generating schemas: %w", err)
+		}
+		for name, content := range schemas {
+			files[filepath.Join(options.SchemaOutput, name)] = content
+		}
+	}
+	return files, nil
+}
+
+func Check(files map[string][]byte, options Options) error { //REVIEW: reports missing, outdated and leftover generated files
+	var stale []string
+	for path, content := range files {
+		current, err := os.ReadFile(path)
+		if err != nil || !bytes.Equal(current, content) {
+			stale = append(stale, path)
+		}
+	}
+	if options.SchemaOutput != "" {
+		existing, _ := filepath.Glob(filepath.Join(options.SchemaOutput, "*.schema.json"))
+		for _, path := range existing {
+			if _, ok := files[path]; !ok {
+				stale = append(stale, path)
+			}
+		}
+	}
+	if len(stale) > 0 {
+		sort.Strings(stale)
+		return fmt.Errorf("%w, run go generate: %s", ErrStale, strings.Join(stale, ", "))
+	}
+	return nil
+}
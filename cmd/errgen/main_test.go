@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ErrgenTestSuite struct {
+	suite.Suite
+}
+
+func TestErrgenTestSuite(t *testing.T) {
+	suite.Run(t, new(ErrgenTestSuite))
+}
+
+func (suite *ErrgenTestSuite) TestProjectCatalogIsUpToDate() {
+	err := Run(Options{
+		Catalog:      "../../internal/errors.yaml",
+		GoOutput:     "../../internal/mapping_gen.go",
+		DocsOutput:   "../../docs/errors.md",
+		SchemaOutput: "../../docs/schemas",
+		ErrorsImport: "github.com/vfcoelho/go-project-pocs/internal/errors",
+		Check:        true,
+	})
+	assert.NoError(suite.T(), err, "generated error files are stale, run go generate ./internal")
+}
+
+func (suite *ErrgenTestSuite) TestGenerate() {
+
+	catalogFile := func(content string) Options {
+		dir := suite.T().TempDir()
+		path := filepath.Join(dir, "errors.yaml")
+		_ = os.WriteFile(path, []byte(content), 0o644)
+		return Options{
+			Catalog:      path,
+			GoOutput:     filepath.Join(dir, "mapping_gen.go"),
+			DocsOutput:   filepath.Join(dir, "errors.md"),
+			SchemaOutput: filepath.Join(dir, "schemas"),
+			ErrorsImport: "example.com/errors",
+		}
+	}
+	const catalog = `
+package: test
+codes:
+  - name: TEST_CODE
+    code: test.code
+    status: 400
+    grpc_code: InvalidArgument
+    class: throttled
+    retry_after: 1500ms
+    severity: info
+    message: test
+    data:
+      name: TestData
+      fields:
+        - name: created_at
+          type: datetime
+        - name: email
+          type: string
+          redact: mask
+`
+
+	suite.Run("generates every file and passes the check", func() {
+		options := catalogFile(catalog)
+		assert.NoError(suite.T(), Run(options))
+
+		content, _ := os.ReadFile(options.GoOutput)
+		assert.Contains(suite.T(), string(content), `TEST_CODE errors.ErrorCode = "test.code"`)
+		assert.Contains(suite.T(), string(content), "CreatedAt time.Time `json:\"created_at,omitempty\"`")
+		assert.Contains(suite.T(), string(content), "Email     string    `json:\"email,omitempty\" redact:\"mask\"`")
+		assert.Contains(suite.T(), string(content), "Severity:   errors.SeverityInfo,")
+		assert.Contains(suite.T(), string(content), "Class:      errors.ClassThrottled,")
+		assert.Contains(suite.T(), string(content), "TEST_CODE: codes.InvalidArgument,")
+		assert.Contains(suite.T(), string(content), "RetryAfter: 1500 * time.Millisecond,")
+		assert.FileExists(suite.T(), options.DocsOutput)
+		assert.FileExists(suite.T(), filepath.Join(options.SchemaOutput, "test.code.schema.json"))
+
+		options.Check = true
+		assert.NoError(suite.T(), Run(options))
+	})
+	suite.Run("check fails on outdated and leftover files", func() {
+		options := catalogFile(catalog)
+		assert.NoError(suite.T(), Run(options))
+		_ = os.WriteFile(options.DocsOutput, []byte("outdated"), 0o644)
+		_ = os.WriteFile(filepath.Join(options.SchemaOutput, "removed.schema.json"), []byte("{}"), 0o644)
+
+		options.Check = true
+		err := Run(options)
+		assert.ErrorIs(suite.T(), err, ErrStale)
+		assert.Contains(suite.T(), err.Error(), "errors.md")
+		assert.Contains(suite.T(), err.Error(), "removed.schema.json")
+	})
+	suite.Run("check fails on missing files", func() {
+		options := catalogFile(catalog)
+		options.Check = true
+		assert.ErrorIs(suite.T(), Run(options), ErrStale)
+	})
+	suite.Run("invalid catalogs are rejected", func() {
+		options := catalogFile(`
+package: test
+codes:
+  - name: TEST_CODE
+    code: Test Code
+    aliases: [Old Code]
+    status: 1000
+    grpc_code: Missing
+    severity: fatal
+    class: fatal
+    retry_after: soon
+    data:
+      name: TEST_CODE
+      fields:
+        - name: id
+          type: object
+          redact: always
+`)
+		err := Run(options)
+		assert.ErrorContains(suite.T(), err, "invalid or duplicated code")
+		assert.ErrorContains(suite.T(), err, "invalid or duplicated alias")
+		assert.ErrorContains(suite.T(), err, "invalid status")
+		assert.ErrorContains(suite.T(), err, "invalid grpc code")
+		assert.ErrorContains(suite.T(), err, "invalid severity")
+		assert.ErrorContains(suite.T(), err, "invalid class")
+		assert.ErrorContains(suite.T(), err, "invalid retry after")
+		assert.ErrorContains(suite.T(), err, "invalid or duplicated data name")
+		assert.ErrorContains(suite.T(), err, "unsupported type")
+		assert.ErrorContains(suite.T(), err, "invalid redact")
+	})
+	suite.Run("json catalogs are supported", func() {
+		options := catalogFile("")
+		options.Catalog = filepath.Join(filepath.Dir(options.Catalog), "errors.json")
+		_ = os.WriteFile(options.Catalog, []byte(`{"package": "test", "codes": [{"name": "TEST_CODE", "code": "test"}]}`), 0o644)
+		assert.NoError(suite.T(), Run(options))
+	})
+}
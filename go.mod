@@ -8,6 +8,10 @@ require (
 	github.com/google/uuid v1.5.0
 	github.com/samber/lo v1.39.0
 	github.com/stretchr/testify v1.9.0
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237
+	google.golang.org/grpc v1.60.1
+	google.golang.org/protobuf v1.33.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -15,6 +19,7 @@ require (
 	github.com/billziss-gh/netgob v0.0.0-20170922182552-157642ec0372 // indirect
 	github.com/billziss-gh/netjson v0.0.0-20170922182520-a9fb8f764298 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
 	github.com/gorilla/websocket v1.5.1 // indirect
 	github.com/klauspost/compress v1.17.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
@@ -28,5 +33,5 @@ require (
 	golang.org/x/exp v0.0.0-20220303212507-bbda1eaf7a17 // indirect
 	golang.org/x/net v0.17.0 // indirect
 	golang.org/x/sys v0.21.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/text v0.14.0 // indirect
 )
@@ -0,0 +1,229 @@
+package errors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrMissingMessage     = errors.New("missing message for error code")
+	ErrUnknownMessage     = errors.New("message for unregistered error code")
+	ErrUnknownPlaceholder = errors.New("message placeholder not found in error data")
+	ErrMissingLocale      = errors.New("missing default locale")
+)
+
+var placeholderPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+const catalogFileExtension = ".json"
+
+type Catalog struct { //REVIEW: localized public messages per error code, placeholders like {id} are filled from the error data
+	defaultLocale string
+	messages      map[string]map[ErrorCode]string
+}
+
+func NewCatalog(defaultLocale string) *Catalog {
+	return &Catalog{defaultLocale: defaultLocale, messages: make(map[string]map[ErrorCode]string)}
+}
+
+func LoadCatalog(fsys fs.FS, defaultLocale string) (*Catalog, error) { //REVIEW: every json file in the root of fsys is a locale, named after it (e.g. en.json, pt-BR.json)
+	catalog := NewCatalog(defaultLocale)
+	files, err := fs.Glob(fsys, "*"+catalogFileExtension)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var messages map[ErrorCode]string
+		if err := json.Unmarshal(content, &messages); err != nil {
+			return nil, fmt.Errorf("error parsing catalog %s: %w", file, err)
+		}
+		catalog.Add(strings.TrimSuffix(path.Base(file), catalogFileExtension), messages)
+	}
+	if _, ok := catalog.messages[defaultLocale]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMissingLocale, defaultLocale)
+	}
+	return catalog, nil
+}
+
+func MustLoadCatalog(fsys fs.FS, defaultLocale string, registry *Registry) *Catalog { //REVIEW: panics so broken catalogs break the application at startup
+	catalog, err := LoadCatalog(fsys, defaultLocale)
+	if err == nil {
+		err = catalog.Validate(registry)
+	}
+	if err != nil {
+		panic(err)
+	}
+	return catalog
+}
+
+func (c *Catalog) Add(locale string, messages map[ErrorCode]string) {
+	if _, ok := c.messages[locale]; !ok {
+		c.messages[locale] = make(map[ErrorCode]string, len(messages))
+	}
+	for code, message := range messages {
+		c.messages[locale][code] = message
+	}
+}
+
+func (c *Catalog) DefaultLocale() string {
+	return c.defaultLocale
+}
+
+func (c *Catalog) Locales() []string {
+	locales := make([]string, 0, len(c.messages))
+	for locale := range c.messages {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+func (c *Catalog) Message(locale string, code ErrorCode, data any) (message string, ok bool) { //REVIEW: falls back to the nearest ancestor code with a message in the locale and only then to the default locale
+	message, ok = c.lookup(locale, code)
+	if !ok {
+		message, ok = c.lookup(c.defaultLocale, code)
+	}
+	if !ok {
+		return "", false
+	}
+	values := dataValues(data)
+	return placeholderPattern.ReplaceAllStringFunc(message, func(placeholder string) string {
+		if value, ok := values[strings.Trim(placeholder, "{}")]; ok {
+			return fmt.Sprint(value)
+		}
+		return placeholder
+	}), true
+}
+
+func (c *Catalog) lookup(locale string, code ErrorCode) (message string, ok bool) {
+	for _, ancestor := range code.Ancestors() {
+		if message, ok = c.messages[locale][ancestor]; ok {
+			return
+		}
+	}
+	return
+}
+
+func (c *Catalog) Negotiate(acceptLanguage string) string { //REVIEW: picks the best locale for an Accept-Language header, matching exact tags first and then their base language
+	type preference struct {
+		tag     string
+		quality float64
+	}
+	var preferences []preference
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = parsed
+			}
+		}
+		if quality > 0 {
+			preferences = append(preferences, preference{tag: tag, quality: quality})
+		}
+	}
+	sort.SliceStable(preferences, func(i, j int) bool { return preferences[i].quality > preferences[j].quality })
+
+	locales := c.Locales()
+	for _, preference := range preferences {
+		for _, locale := range locales {
+			if strings.EqualFold(locale, preference.tag) {
+				return locale
+			}
+		}
+		base, _, _ := strings.Cut(preference.tag, "-")
+		for _, locale := range locales {
+			localeBase, _, _ := strings.Cut(locale, "-")
+			if strings.EqualFold(localeBase, base) {
+				return locale
+			}
+		}
+	}
+	return c.defaultLocale
+}
+
+func (c *Catalog) Validate(registry *Registry) error { //REVIEW: every locale must cover every registered code, directly or through an ancestor, using only placeholders available on the code data type
+	var errs []error
+	if _, ok := c.messages[c.defaultLocale]; !ok {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrMissingLocale, c.defaultLocale))
+	}
+	for _, locale := range c.Locales() {
+		messages := c.messages[locale]
+		for _, code := range registry.Codes() {
+			covered := false
+			for _, ancestor := range code.Ancestors() {
+				if _, covered = messages[ancestor]; covered {
+					break
+				}
+			}
+			if !covered {
+				errs = append(errs, fmt.Errorf("%w: %s %v", ErrMissingMessage, locale, code))
+			}
+		}
+		for code, message := range messages {
+			definition, ok := registry.Lookup(code)
+			if !ok {
+				errs = append(errs, fmt.Errorf("%w: %s %v", ErrUnknownMessage, locale, code))
+				continue
+			}
+			fields := dataFields(definition.DataType)
+			for _, match := range placeholderPattern.FindAllStringSubmatch(message, -1) {
+				if !fields[match[1]] {
+					errs = append(errs, fmt.Errorf("%w: %s %v {%s}", ErrUnknownPlaceholder, locale, code, match[1]))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func dataValues(data any) map[string]any { //REVIEW: data is read through its json representation so placeholders match the json field names
+	if data == nil {
+		return nil
+	}
+	content, err := json.Marshal(data)
+	if err != nil {
+		return nil
+	}
+	var values map[string]any
+	_ = json.Unmarshal(content, &values)
+	return values
+}
+
+func dataFields(dataType reflect.Type) map[string]bool {
+	fields := make(map[string]bool)
+	for dataType != nil && dataType.Kind() == reflect.Pointer {
+		dataType = dataType.Elem()
+	}
+	if dataType == nil || dataType.Kind() != reflect.Struct {
+		return fields
+	}
+	for _, field := range reflect.VisibleFields(dataType) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+		fields[name] = true
+	}
+	return fields
+}
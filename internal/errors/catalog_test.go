@@ -0,0 +1,85 @@
+package errors
+
+import (
+	"reflect"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *ErrorsTestSuite) TestCatalog() {
+
+	type testData struct {
+		ID      int    `json:"id"`
+		Name    string `json:"name,omitempty"`
+		Ignored string `json:"-"`
+	}
+	const TEST_CODE ErrorCode = "TEST_CODE"
+	const OTHER_TEST_CODE ErrorCode = "OTHER_TEST_CODE"
+
+	registry := NewRegistry().MustRegister(
+		CodeDefinition{Code: TEST_CODE, DataType: reflect.TypeFor[testData]()},
+		CodeDefinition{Code: OTHER_TEST_CODE},
+	)
+	files := fstest.MapFS{
+		"en.json":    {Data: []byte(`{"TEST_CODE": "test {id} {name} {missing}", "OTHER_TEST_CODE": "other test"}`)},
+		"pt-BR.json": {Data: []byte(`{"TEST_CODE": "teste {id}"}`)},
+	}
+
+	suite.Run("catalog loads one locale per file", func() {
+		catalog, err := LoadCatalog(files, "en")
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), []string{"en", "pt-BR"}, catalog.Locales())
+	})
+	suite.Run("catalog without the default locale fails to load", func() {
+		_, err := LoadCatalog(files, "es")
+		assert.ErrorIs(suite.T(), err, ErrMissingLocale)
+	})
+	suite.Run("catalog fills placeholders from data and falls back to the default locale", func() {
+		catalog, _ := LoadCatalog(files, "en")
+
+		message, ok := catalog.Message("pt-BR", TEST_CODE, testData{ID: 1})
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), "teste 1", message)
+
+		message, ok = catalog.Message("en", TEST_CODE, &testData{ID: 1, Name: "test"})
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), "test 1 test {missing}", message)
+
+		message, ok = catalog.Message("pt-BR", OTHER_TEST_CODE, nil)
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), "other test", message)
+
+		_, ok = catalog.Message("pt-BR", "UNKNOWN_CODE", nil)
+		assert.False(suite.T(), ok)
+	})
+	suite.Run("catalog negotiates locales from the accept language header", func() {
+		catalog, _ := LoadCatalog(files, "en")
+		assert.Equal(suite.T(), "pt-BR", catalog.Negotiate("pt-br"))
+		assert.Equal(suite.T(), "pt-BR", catalog.Negotiate("fr, pt-PT;q=0.8, en;q=0.5"))
+		assert.Equal(suite.T(), "en", catalog.Negotiate("pt;q=0.5, en-US"))
+		assert.Equal(suite.T(), "en", catalog.Negotiate("pt;q=0, *"))
+		assert.Equal(suite.T(), "en", catalog.Negotiate(""))
+	})
+	suite.Run("catalog validation reports missing codes and unknown placeholders", func() {
+		catalog, _ := LoadCatalog(files, "en")
+		err := catalog.Validate(registry)
+		assert.ErrorIs(suite.T(), err, ErrMissingMessage)
+		assert.ErrorIs(suite.T(), err, ErrUnknownPlaceholder)
+		assert.Contains(suite.T(), err.Error(), "pt-BR OTHER_TEST_CODE")
+		assert.Contains(suite.T(), err.Error(), "en TEST_CODE {missing}")
+	})
+	suite.Run("catalog validation reports messages for unregistered codes", func() {
+		catalog := NewCatalog("en")
+		catalog.Add("en", map[ErrorCode]string{TEST_CODE: "test {id}", OTHER_TEST_CODE: "other test", "UNKNOWN_CODE": "unknown"})
+		assert.ErrorIs(suite.T(), catalog.Validate(registry), ErrUnknownMessage)
+	})
+	suite.Run("valid catalog passes validation", func() {
+		catalog := NewCatalog("en")
+		catalog.Add("en", map[ErrorCode]string{TEST_CODE: "test {id} {name}", OTHER_TEST_CODE: "other test"})
+		assert.NoError(suite.T(), catalog.Validate(registry))
+		assert.NotPanics(suite.T(), func() {
+			MustLoadCatalog(fstest.MapFS{"en.json": {Data: []byte(`{"TEST_CODE": "test", "OTHER_TEST_CODE": "other test"}`)}}, "en", registry)
+		})
+	})
+}
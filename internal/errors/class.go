@@ -0,0 +1,78 @@
+package errors
+
+import (
+	"cmp"
+	"time"
+)
+
+type Class string //REVIEW: classifies failures so transports know whether they are worth retrying
+
+const (
+	ClassTransient Class = "transient" // temporary failure, retrying may succeed
+	ClassPermanent Class = "permanent" // retrying will always fail
+	ClassThrottled Class = "throttled" // rejected by rate limiting, retry after a while
+	ClassConflict  Class = "conflict"  // conflicts with the current state, only succeeds if the state changes
+)
+
+func (c Class) Retryable() bool {
+	return c == ClassTransient || c == ClassThrottled
+}
+
+func (r *Registry) Classify(err error) (class Class) { //REVIEW: class of the first custom error in the tree defining one, either by itself or through its code definitions
+	walk(err, func(err error) bool {
+		if customErr, isCustom := asError(err); isCustom {
+			class = cmp.Or(customErr.Class, r.codeClass(customErr.Code))
+		}
+		return class == ""
+	})
+	return
+}
+
+func (r *Registry) codeClass(code ErrorCode) Class { //REVIEW: class of the code or of its nearest ancestor defining one
+	for _, ancestor := range code.Ancestors() {
+		definition, ok := r.Lookup(ancestor)
+		switch {
+		case ok && definition.Class != "":
+			return definition.Class
+		case ok && definition.Retryable:
+			return ClassTransient
+		}
+	}
+	return ""
+}
+
+func (r *Registry) IsRetryable(err error) bool {
+	return r.Classify(err).Retryable()
+}
+
+func (r *Registry) RetryAfter(err error) (delay time.Duration, ok bool) { //REVIEW: delay requested by the first custom error in the tree defining one, either by itself or through its code definitions
+	walk(err, func(err error) bool {
+		if customErr, isCustom := asError(err); isCustom {
+			delay = cmp.Or(customErr.RetryAfter, r.codeRetryAfter(customErr.Code))
+		}
+		ok = delay > 0
+		return !ok
+	})
+	return
+}
+
+func (r *Registry) codeRetryAfter(code ErrorCode) time.Duration {
+	for _, ancestor := range code.Ancestors() {
+		if definition, ok := r.Lookup(ancestor); ok && definition.RetryAfter > 0 {
+			return definition.RetryAfter
+		}
+	}
+	return 0
+}
+
+func Classify(err error) Class {
+	return DefaultRegistry.Classify(err)
+}
+
+func IsRetryable(err error) bool {
+	return DefaultRegistry.IsRetryable(err)
+}
+
+func RetryAfter(err error) (time.Duration, bool) {
+	return DefaultRegistry.RetryAfter(err)
+}
@@ -0,0 +1,77 @@
+package errors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *ErrorsTestSuite) TestClassification() {
+
+	sentinelError := errors.New("test error")
+	const TEST_NAMESPACE ErrorCode = "test"
+	const TEST_TRANSIENT_CODE ErrorCode = "test.transient"
+	const TEST_RETRYABLE_CODE ErrorCode = "test.retryable"
+	const TEST_CHILD_CODE ErrorCode = "test.transient.child"
+
+	registry := NewRegistry().MustRegister(
+		CodeDefinition{Code: TEST_NAMESPACE, Class: ClassPermanent},
+		CodeDefinition{Code: TEST_TRANSIENT_CODE, Class: ClassTransient, RetryAfter: time.Second},
+		CodeDefinition{Code: TEST_RETRYABLE_CODE, Retryable: true},
+	)
+
+	suite.Run("classes know whether they are retryable", func() {
+		assert.True(suite.T(), ClassTransient.Retryable())
+		assert.True(suite.T(), ClassThrottled.Retryable())
+		assert.False(suite.T(), ClassPermanent.Retryable())
+		assert.False(suite.T(), ClassConflict.Retryable())
+		assert.False(suite.T(), Class("").Retryable())
+	})
+	suite.Run("class is taken from the error before its code definition", func() {
+		err := fmt.Errorf("wrapper: %w", NewError(sentinelError, WithCode(TEST_TRANSIENT_CODE), WithClass(ClassThrottled)))
+		assert.Equal(suite.T(), ClassThrottled, registry.Classify(err))
+	})
+	suite.Run("class is taken from the nearest code definition through wrapped errors", func() {
+		assert.Equal(suite.T(), ClassTransient, registry.Classify(NewError(NewError(sentinelError, WithCode(TEST_CHILD_CODE)))))
+		assert.Equal(suite.T(), ClassTransient, registry.Classify(NewError(sentinelError, WithCode(TEST_RETRYABLE_CODE))))
+		assert.Equal(suite.T(), ClassPermanent, registry.Classify(NewError(sentinelError, WithCode("test.other"))))
+		assert.True(suite.T(), registry.IsRetryable(fmt.Errorf("wrapper: %w", NewError(sentinelError, WithCode(TEST_CHILD_CODE)))))
+	})
+	suite.Run("class and retry after are taken through joined and pointer wrapped errors", func() {
+		pointerErr := NewError(sentinelError, WithCode(TEST_TRANSIENT_CODE))
+		err := errors.Join(sentinelError, &pointerErr)
+		assert.Equal(suite.T(), ClassTransient, registry.Classify(err))
+		delay, ok := registry.RetryAfter(err)
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), time.Second, delay)
+	})
+	suite.Run("errors without class are not retryable", func() {
+		assert.Equal(suite.T(), Class(""), registry.Classify(sentinelError))
+		assert.Equal(suite.T(), Class(""), registry.Classify(NewError(sentinelError, WithCode("other"))))
+		assert.False(suite.T(), registry.IsRetryable(sentinelError))
+	})
+	suite.Run("retry after is taken from the error before its code definition", func() {
+		delay, ok := registry.RetryAfter(NewError(sentinelError, WithCode(TEST_TRANSIENT_CODE), WithRetryAfter(time.Minute)))
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), time.Minute, delay)
+
+		delay, ok = registry.RetryAfter(fmt.Errorf("wrapper: %w", NewError(sentinelError, WithCode(TEST_CHILD_CODE))))
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), time.Second, delay)
+
+		_, ok = registry.RetryAfter(NewError(sentinelError, WithCode(TEST_RETRYABLE_CODE)))
+		assert.False(suite.T(), ok)
+	})
+	suite.Run("class and retry after round trip through json", func() {
+		data, _ := json.Marshal(NewError(sentinelError, WithClass(ClassThrottled), WithRetryAfter(1500*time.Millisecond)))
+		assert.Contains(suite.T(), string(data), `"class":"throttled","retry_after_ms":1500`)
+
+		var decoded Error
+		assert.NoError(suite.T(), json.Unmarshal(data, &decoded))
+		assert.Equal(suite.T(), ClassThrottled, decoded.Class)
+		assert.Equal(suite.T(), 1500*time.Millisecond, decoded.RetryAfter)
+	})
+}
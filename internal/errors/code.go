@@ -0,0 +1,25 @@
+package errors
+
+import "strings"
+
+const CodeSeparator = "." //REVIEW: error codes are hierarchical namespaces, e.g. record.conflict.already_exists
+
+func (c ErrorCode) Parent() ErrorCode { //REVIEW: enclosing namespace of the code, empty for root codes
+	index := strings.LastIndex(string(c), CodeSeparator)
+	if index < 0 {
+		return ""
+	}
+	return c[:index]
+}
+
+func (c ErrorCode) Within(namespace ErrorCode) bool { //REVIEW: a code is within itself and every one of its ancestors
+	return c == namespace || (namespace != "" && strings.HasPrefix(string(c), string(namespace)+CodeSeparator))
+}
+
+func (c ErrorCode) Ancestors() []ErrorCode { //REVIEW: the code followed by its ancestors, from the nearest to the root
+	var codes []ErrorCode
+	for code := c; code != ""; code = code.Parent() {
+		codes = append(codes, code)
+	}
+	return codes
+}
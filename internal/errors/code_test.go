@@ -0,0 +1,103 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *ErrorsTestSuite) TestHierarchicalCodes() {
+
+	sentinelError := errors.New("test error")
+	const TEST_NAMESPACE ErrorCode = "test"
+	const TEST_CONFLICT_CODE ErrorCode = "test.conflict"
+	const TEST_EXISTS_CODE ErrorCode = "test.conflict.already_exists"
+	const TEST_MISSING_CODE ErrorCode = "test.not_found"
+
+	suite.Run("codes know their ancestors", func() {
+		assert.Equal(suite.T(), TEST_CONFLICT_CODE, TEST_EXISTS_CODE.Parent())
+		assert.Equal(suite.T(), ErrorCode(""), TEST_NAMESPACE.Parent())
+		assert.Equal(suite.T(), []ErrorCode{TEST_EXISTS_CODE, TEST_CONFLICT_CODE, TEST_NAMESPACE}, TEST_EXISTS_CODE.Ancestors())
+	})
+	suite.Run("codes are within themselves and their namespaces only", func() {
+		assert.True(suite.T(), TEST_EXISTS_CODE.Within(TEST_EXISTS_CODE))
+		assert.True(suite.T(), TEST_EXISTS_CODE.Within(TEST_CONFLICT_CODE))
+		assert.True(suite.T(), TEST_EXISTS_CODE.Within(TEST_NAMESPACE))
+		assert.False(suite.T(), TEST_CONFLICT_CODE.Within(TEST_EXISTS_CODE))
+		assert.False(suite.T(), TEST_MISSING_CODE.Within(TEST_CONFLICT_CODE))
+		assert.False(suite.T(), ErrorCode("testing").Within(TEST_NAMESPACE))
+		assert.False(suite.T(), TEST_NAMESPACE.Within(""))
+	})
+	suite.Run("custom error is any of its code namespaces", func() {
+		err := fmt.Errorf("wrapper: %w", NewError(sentinelError, WithCode(TEST_EXISTS_CODE)))
+		assert.ErrorIs(suite.T(), err, NewIsComparable(TEST_NAMESPACE))
+		assert.ErrorIs(suite.T(), err, NewIsComparable(TEST_CONFLICT_CODE))
+		assert.NotErrorIs(suite.T(), err, NewIsComparable(TEST_MISSING_CODE))
+		assert.NotErrorIs(suite.T(), NewError(sentinelError, WithCode(TEST_CONFLICT_CODE)), NewIsComparable(TEST_EXISTS_CODE))
+	})
+	suite.Run("registry resolves the nearest registered ancestor", func() {
+		registry := NewRegistry().MustRegister(
+			CodeDefinition{Code: TEST_NAMESPACE, Message: "test"},
+			CodeDefinition{Code: TEST_CONFLICT_CODE, HTTPStatus: 409},
+			CodeDefinition{Code: TEST_EXISTS_CODE, Message: "already exists"},
+		)
+
+		definition, ok := registry.Resolve(TEST_EXISTS_CODE)
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), "already exists", definition.Message)
+
+		definition, ok = registry.Resolve(TEST_MISSING_CODE)
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), TEST_NAMESPACE, definition.Code)
+
+		_, ok = registry.Resolve("other")
+		assert.False(suite.T(), ok)
+
+		status, ok := registry.HTTPStatus(TEST_EXISTS_CODE)
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), 409, status)
+
+		_, ok = registry.HTTPStatus(TEST_MISSING_CODE)
+		assert.False(suite.T(), ok)
+	})
+	suite.Run("catalog falls back to the nearest ancestor message", func() {
+		registry := NewRegistry().MustRegister(CodeDefinition{Code: TEST_NAMESPACE}, CodeDefinition{Code: TEST_MISSING_CODE})
+		catalog := NewCatalog("en")
+		catalog.Add("en", map[ErrorCode]string{TEST_NAMESPACE: "test"})
+
+		message, ok := catalog.Message("en", TEST_MISSING_CODE, nil)
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), "test", message)
+		assert.NoError(suite.T(), catalog.Validate(registry))
+	})
+	suite.Run("catalog prefers the requested locale on any ancestor over the default locale", func() {
+		catalog := NewCatalog("en")
+		catalog.Add("en", map[ErrorCode]string{TEST_NAMESPACE: "test", TEST_MISSING_CODE: "not found"})
+		catalog.Add("pt-BR", map[ErrorCode]string{TEST_NAMESPACE: "teste"})
+
+		message, ok := catalog.Message("pt-BR", TEST_MISSING_CODE, nil)
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), "teste", message)
+	})
+	suite.Run("former codes are aliases of their current code", func() {
+		registry := NewRegistry().MustRegister(CodeDefinition{Code: TEST_MISSING_CODE, HTTPStatus: 404, Aliases: []ErrorCode{"test_not_found"}})
+
+		definition, ok := registry.Lookup("test_not_found")
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), TEST_MISSING_CODE, definition.Code)
+		assert.Equal(suite.T(), TEST_MISSING_CODE, registry.Canonical("test_not_found"))
+		assert.Equal(suite.T(), ErrorCode("other"), registry.Canonical("other"))
+		assert.Equal(suite.T(), []ErrorCode{TEST_MISSING_CODE}, registry.Codes())
+
+		decoded, err := registry.Unmarshal([]byte(`{"error":"test error","code":"test_not_found"}`))
+		assert.NoError(suite.T(), err)
+		assert.ErrorIs(suite.T(), decoded, NewIsComparable(TEST_NAMESPACE))
+	})
+	suite.Run("aliases cannot collide with codes or other aliases", func() {
+		registry := NewRegistry().MustRegister(CodeDefinition{Code: TEST_MISSING_CODE, Aliases: []ErrorCode{"test_not_found"}})
+		assert.ErrorIs(suite.T(), registry.Register(CodeDefinition{Code: TEST_NAMESPACE, Aliases: []ErrorCode{"test_not_found"}}), ErrDuplicateAlias)
+		assert.ErrorIs(suite.T(), registry.Register(CodeDefinition{Code: TEST_NAMESPACE, Aliases: []ErrorCode{TEST_MISSING_CODE}}), ErrDuplicateAlias)
+		assert.ErrorIs(suite.T(), registry.Register(CodeDefinition{Code: "test_not_found"}), ErrDuplicateCode)
+	})
+}
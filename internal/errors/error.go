@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"reflect"
+	"time"
 )
 
 //REVIEW: the errors package is built to be used as a potential standalone package for error handling in go projects
@@ -11,52 +14,257 @@ import (
 type ErrorCode string //REVIEW: defines type to create error codes
 
 type Error struct { //REVIEW: defines a custom error type to add functionality fo debugging, logging and responding API calls
-	Err  error     `json:"error,omitempty"`
-	Code ErrorCode `json:"code,omitempty"`
-	Data any       `json:"data,omitempty"`
+	Err           error         `json:"error,omitempty"`
+	Code          ErrorCode     `json:"code,omitempty"`
+	Data          any           `json:"data,omitempty"`
+	Message       string        `json:"message,omitempty"`        //REVIEW: public message, safe to be shown to callers unlike the internal cause
+	CorrelationID string        `json:"correlation_id,omitempty"` //REVIEW: identifies an error occurrence on both the response and the logs, always generated by the service
+	RequestID     string        `json:"request_id,omitempty"`     //REVIEW: id sent by the caller, only kept once validated since it is echoed back
+	Class         Class         `json:"class,omitempty"`          //REVIEW: overrides the class of the code definition, telling whether the failure is worth retrying
+	RetryAfter    time.Duration `json:"retry_after_ms,omitempty"` //REVIEW: overrides the retry delay of the code definition
+
+	stack *stack //REVIEW: kept behind a pointer so the error stays comparable with ==
 }
 
 type payloadError struct {
-	Err  string    `json:"error,omitempty"`
-	Code ErrorCode `json:"code,omitempty"`
-	Data any       `json:"data,omitempty"`
+	Err           string    `json:"error,omitempty"`
+	Code          ErrorCode `json:"code,omitempty"`
+	Data          any       `json:"data,omitempty"`
+	Message       string    `json:"message,omitempty"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	RequestID     string    `json:"request_id,omitempty"`
+	Class         Class     `json:"class,omitempty"`
+	RetryAfter    int64     `json:"retry_after_ms,omitempty"`
+	Causes        []any     `json:"causes,omitempty"`
+	Frames        []Frame   `json:"frames,omitempty"`
+}
+
+type multiError interface { //REVIEW: implemented by errors.Join and fmt.Errorf with multiple %w verbs
+	Unwrap() []error
 }
 
 func (he Error) Error() string { //REVIEW: custom error is a go error
 	return fmt.Errorf("%v: %w", he.Code, he.Err).Error()
 }
 
-func (he Error) Is(target error) bool { //REVIEW: Is method evaluates error code in order to match different data and wrapped errors
+func (he Error) Is(target error) bool { //REVIEW: Is method evaluates error code in order to match different data and wrapped errors, a parent namespace code matches all of its children
 	var targetError Error
 	if errors.As(target, &targetError) {
-		return targetError.Code == he.Code
+		return he.Code.Within(targetError.Code)
 	}
 	return errors.Is(he.Err, target)
 }
 
+func (he Error) Frames() []Frame { //REVIEW: call site where the error was created, or the full stack when built WithStack
+	if he.stack == nil {
+		return nil
+	}
+	return resolveFrames(he.stack.pcs)
+}
+
+func (he Error) Causes() []error { //REVIEW: every branch of a joined error, nil when the error has a single cause
+	if joined, ok := he.Err.(multiError); ok {
+		return joined.Unwrap()
+	}
+	return nil
+}
+
+func (he Error) Format(s fmt.State, verb rune) { //REVIEW: %+v prints the error followed by the frames of every custom error in the chain
+	switch {
+	case verb == 'v' && s.Flag('+'):
+		io.WriteString(s, he.Error())
+		formatFrames(s, he, 0)
+	case verb == 'q':
+		fmt.Fprintf(s, "%q", he.Error())
+	default:
+		io.WriteString(s, he.Error())
+	}
+}
+
+func formatFrames(s fmt.State, err error, depth int) {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if customErr, ok := asError(err); ok {
+			if depth > 0 {
+				fmt.Fprintf(s, "\ncaused by: %v", customErr)
+			}
+			for _, frame := range customErr.Frames() {
+				fmt.Fprintf(s, "\n%s\n\t%s:%d", frame.Function, frame.File, frame.Line)
+			}
+			depth++
+		}
+		if joined, ok := err.(multiError); ok {
+			for _, cause := range joined.Unwrap() {
+				formatFrames(s, cause, depth)
+			}
+			return
+		}
+	}
+}
+
+type MarshalOption func(*marshalConfig) //REVIEW: provides with-builder methods to configure how errors are serialized
+
+type marshalConfig struct {
+	frames bool
+}
+
+func WithFrames() MarshalOption { //REVIEW: serializes the call site frames, they expose source paths so it should only be used in debug mode
+	return func(mc *marshalConfig) {
+		mc.frames = true
+	}
+}
+
 func (he Error) MarshalJSON() ([]byte, error) { //REVIEW: also marshalable to json for later logging
-	return json.Marshal(payloadError{
-		Err:  he.Err.Error(),
-		Code: he.Code,
-		Data: he.Data,
-	})
+	return he.MarshalJSONWith()
+}
+
+func (he Error) MarshalJSONWith(opts ...MarshalOption) ([]byte, error) {
+	var config marshalConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return json.Marshal(he.payload(config))
+}
+
+func (he Error) payload(config marshalConfig) payloadError {
+	payload := payloadError{
+		Code:          he.Code,
+		Data:          he.RedactedData(TargetResponse), //REVIEW: serialized errors are sent to callers, so sensitive data is redacted
+		Message:       he.Message,
+		CorrelationID: he.CorrelationID,
+		RequestID:     he.RequestID,
+		Class:         he.Class,
+		RetryAfter:    he.RetryAfter.Milliseconds(),
+	}
+	if he.Err != nil {
+		payload.Err = he.Err.Error()
+	}
+	for _, cause := range he.Causes() { //REVIEW: each cause of a joined error keeps its own code and data
+		payload.Causes = append(payload.Causes, marshalableCause(cause, config))
+	}
+	if config.frames {
+		payload.Frames = he.Frames()
+	}
+	return payload
+}
+
+func marshalableCause(cause error, config marshalConfig) any {
+	var customErr Error
+	if errors.As(cause, &customErr) { //REVIEW: custom errors wrapped by other errors in a branch still expose their code and data
+		return customErr.payload(config)
+	}
+	return payloadError{Err: cause.Error()}
 }
 
 func (he Error) Unwrap() error {
 	return he.Err
 }
 
-func (he *Error) UnmarshalJSON(data []byte) error { //REVIEW: also unmarshalable from json for API usage
-	var s payloadError
+func (he *Error) UnmarshalJSON(data []byte) (err error) { //REVIEW: also unmarshalable from json for API usage, typed data is rebuilt through the default registry
+	*he, err = DefaultRegistry.Unmarshal(data)
+	return
+}
+
+func (r *Registry) Unmarshal(data []byte) (Error, error) { //REVIEW: rebuilds a custom error and its causes, typed data is rebuilt into the types registered in this registry
+	var s struct {
+		payloadError
+		Data   json.RawMessage   `json:"data,omitempty"`
+		Causes []json.RawMessage `json:"causes,omitempty"`
+	}
 	if err := json.Unmarshal(data, &s); err != nil {
-		return err
+		return Error{}, err
 	}
-	*he = NewError(errors.New(s.Err), WithCode(s.Code), WithData(s.Data))
-	return nil
+	var err error = errors.New(s.Err)
+	if len(s.Causes) > 0 { //REVIEW: causes are rebuilt as a joined error so every branch can still be matched
+		causes := make([]error, 0, len(s.Causes))
+		for _, data := range s.Causes {
+			cause, err := r.Unmarshal(data)
+			if err != nil {
+				return Error{}, err
+			}
+			causes = append(causes, unmarshaledCause(cause))
+		}
+		err = errors.Join(causes...)
+	}
+	s.Code = r.Canonical(s.Code) //REVIEW: errors sent with a former code still match the current one
+	errData, dataErr := r.UnmarshalData(s.Code, s.Data)
+	if dataErr != nil {
+		return Error{}, fmt.Errorf("error unmarshalling %v data: %w", s.Code, dataErr)
+	}
+	return Error{Err: err, Code: s.Code, Data: errData, Message: s.Message, CorrelationID: s.CorrelationID, RequestID: s.RequestID, Class: s.Class, RetryAfter: time.Duration(s.RetryAfter) * time.Millisecond}, nil //REVIEW: built without NewError so the decoding site is not captured as the error origin
+}
+
+func (r *Registry) UnmarshalData(code ErrorCode, data json.RawMessage) (any, error) { //REVIEW: data is rebuilt into the type registered for the code, falling back to generic json values when it does not fit, e.g. redacted typed fields
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	if definition, ok := r.Lookup(code); ok && definition.DataType != nil {
+		typed := reflect.New(definition.DataType)
+		if err := json.Unmarshal(data, typed.Interface()); err == nil {
+			return typed.Elem().Interface(), nil
+		}
+	}
+	var generic any
+	err := json.Unmarshal(data, &generic)
+	return generic, err
+}
+
+func DataAs[T any](err error) (data T, ok bool) { //REVIEW: typed access to the data of the first custom error in the tree carrying a T
+	walk(err, func(err error) bool {
+		customErr, isCustom := asError(err)
+		if !isCustom {
+			return true
+		}
+		switch value := customErr.Data.(type) {
+		case T:
+			data, ok = value, true
+		case *T:
+			if value != nil {
+				data, ok = *value, true
+			}
+		}
+		return !ok
+	})
+	return
+}
+
+func unmarshaledCause(cause Error) error {
+	if cause.Code == "" && cause.Data == nil && cause.Message == "" && cause.Class == "" && cause.Causes() == nil {
+		return cause.Err
+	}
+	return cause
+}
+
+func walk(err error, visit func(error) bool) bool { //REVIEW: depth first traversal of the whole error tree, stops when visit returns false
+	for ; err != nil; err = errors.Unwrap(err) {
+		if !visit(err) {
+			return false
+		}
+		if joined, ok := err.(multiError); ok {
+			for _, cause := range joined.Unwrap() {
+				if !walk(cause, visit) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return true
+}
+
+func asError(err error) (Error, bool) { //REVIEW: matches a single node of the tree, the custom error either by value or behind a pointer
+	switch customErr := err.(type) {
+	case Error:
+		return customErr, true
+	case *Error:
+		if customErr != nil {
+			return *customErr, true
+		}
+	}
+	return Error{}, false
 }
 
 func NewIsComparable(code ErrorCode) Error {
-	return NewError(nil, WithCode(code))
+	return newError(nil, 1, WithCode(code))
 }
 
 type ErrorOption func(*Error) //REVIEW: provides with-builder methods for convenience
@@ -70,10 +278,66 @@ func WithData(data any) ErrorOption {
 		he.Data = data
 	}
 }
+func WithMessage(message string) ErrorOption {
+	return func(he *Error) {
+		he.Message = message
+	}
+}
+func WithCorrelationID(correlationID string) ErrorOption {
+	return func(he *Error) {
+		he.CorrelationID = correlationID
+	}
+}
+func WithRequestID(requestID string) ErrorOption { //REVIEW: invalid caller ids are dropped instead of being echoed back
+	return func(he *Error) {
+		if ValidRequestID(requestID) {
+			he.RequestID = requestID
+		}
+	}
+}
+
+const maxRequestIDLength = 128
+
+func ValidRequestID(id string) bool { //REVIEW: caller ids are bounded in length and charset so they are safe to log and to send back in headers
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+func WithClass(class Class) ErrorOption {
+	return func(he *Error) {
+		he.Class = class
+	}
+}
+func WithRetryAfter(delay time.Duration) ErrorOption {
+	return func(he *Error) {
+		he.RetryAfter = delay
+	}
+}
+func WithStack() ErrorOption { //REVIEW: captures the full stack instead of only the call site
+	return func(he *Error) {
+		he.stack = &stack{pcs: make([]uintptr, maxStackDepth)}
+	}
+}
 func NewError(err error, opts ...ErrorOption) Error {
+	return newError(err, 1, opts...)
+}
+
+func newError(err error, skip int, opts ...ErrorOption) Error {
 	he := Error{Err: err}
 	for _, opt := range opts {
 		opt(&he)
 	}
+	if he.stack == nil {
+		he.stack = &stack{pcs: make([]uintptr, 1)}
+	}
+	he.stack.pcs = callers(skip+1, he.stack.pcs)
 	return he
 }
@@ -1,8 +1,11 @@
 package errors
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/samber/lo"
@@ -150,3 +153,180 @@ func (suite *ErrorsTestSuite) TestCustomErrorAs() {
 	}))
 
 }
+
+func (suite *ErrorsTestSuite) TestCustomErrorFrames() {
+
+	sentinelError := errors.New("test error")
+	const TEST_CODE ErrorCode = "TEST_CODE"
+
+	suite.Run("custom error captures its creation call site", func() {
+		err := NewError(sentinelError, WithCode(TEST_CODE))
+
+		frames := err.Frames()
+		assert.Len(suite.T(), frames, 1)
+		assert.True(suite.T(), strings.HasSuffix(frames[0].Function, "TestCustomErrorFrames.func1"))
+		assert.True(suite.T(), strings.HasSuffix(frames[0].File, "error_test.go"))
+	})
+	suite.Run("comparable custom error captures its creation call site", func() {
+		frames := NewIsComparable(TEST_CODE).Frames()
+		assert.Len(suite.T(), frames, 1)
+		assert.True(suite.T(), strings.HasSuffix(frames[0].Function, "TestCustomErrorFrames.func2"))
+	})
+	suite.Run("custom error with stack captures the full stack", func() {
+		frames := NewError(sentinelError, WithStack()).Frames()
+		assert.Greater(suite.T(), len(frames), 1)
+		assert.True(suite.T(), strings.HasSuffix(frames[0].Function, "TestCustomErrorFrames.func3"))
+	})
+	suite.Run("plus verb prints the frames of every custom error in the chain", func() {
+		err := NewError(NewError(sentinelError, WithCode(TEST_CODE)))
+
+		formatted := fmt.Sprintf("%+v", err)
+		assert.True(suite.T(), strings.HasPrefix(formatted, err.Error()))
+		assert.Contains(suite.T(), formatted, "caused by: TEST_CODE: test error")
+		assert.Equal(suite.T(), 2, strings.Count(formatted, "error_test.go"))
+		assert.Equal(suite.T(), err.Error(), fmt.Sprintf("%v", err))
+	})
+	suite.Run("frames are only marshalled when asked for", func() {
+		err := NewError(errors.Join(sentinelError, NewError(sentinelError, WithCode(TEST_CODE))), WithCode(TEST_CODE))
+
+		production, _ := json.Marshal(err)
+		assert.NotContains(suite.T(), string(production), "frames")
+
+		debug, _ := err.MarshalJSONWith(WithFrames())
+		assert.Equal(suite.T(), 2, strings.Count(string(debug), `"frames":[{"function":`), "the frames of the causes are marshalled too")
+	})
+	suite.Run("custom error stays comparable", func() {
+		err := NewError(sentinelError, WithCode(TEST_CODE))
+		var target error = err
+
+		assert.NotPanics(suite.T(), func() { _ = target == error(err) })
+		assert.True(suite.T(), target == error(err))
+	})
+	suite.Run("unmarshalled custom error does not capture the decoding site", func() {
+		var err Error
+		assert.NoError(suite.T(), json.Unmarshal([]byte(`{"error":"test error","code":"TEST_CODE"}`), &err))
+		assert.Empty(suite.T(), err.Frames())
+	})
+}
+
+func (suite *ErrorsTestSuite) TestCustomErrorCauses() {
+
+	sentinelError := errors.New("test error")
+	otherSentinelError := errors.New("other test error")
+	const TEST_CODE ErrorCode = "TEST_CODE"
+	const OTHER_TEST_CODE ErrorCode = "OTHER_TEST_CODE"
+	const JOINED_CODE ErrorCode = "JOINED_CODE"
+	const MISSING_CODE ErrorCode = "MISSING_CODE"
+
+	joinedError := NewError(errors.Join(
+		NewError(sentinelError, WithCode(TEST_CODE), WithData("test data")),
+		fmt.Errorf("wrapper: %w", NewError(otherSentinelError, WithCode(OTHER_TEST_CODE))),
+		errors.New("raw error"),
+	), WithCode(JOINED_CODE))
+
+	suite.Run("joined custom error is every branch code", func() {
+		assert.ErrorIs(suite.T(), joinedError, NewIsComparable(JOINED_CODE))
+		assert.ErrorIs(suite.T(), joinedError, NewIsComparable(TEST_CODE))
+		assert.ErrorIs(suite.T(), joinedError, NewIsComparable(OTHER_TEST_CODE))
+		assert.ErrorIs(suite.T(), joinedError, otherSentinelError)
+		assert.NotErrorIs(suite.T(), joinedError, NewIsComparable(MISSING_CODE))
+	})
+	suite.Run("joined custom error exposes its causes", func() {
+		assert.Len(suite.T(), joinedError.Causes(), 3)
+		assert.Nil(suite.T(), NewError(sentinelError).Causes())
+	})
+	suite.Run("joined custom error marshals every cause with its own code and data", func() {
+		data, err := json.Marshal(joinedError)
+		assert.NoError(suite.T(), err)
+		assert.JSONEq(suite.T(), `{
+			"error": "TEST_CODE: test error\nwrapper: OTHER_TEST_CODE: other test error\nraw error",
+			"code": "JOINED_CODE",
+			"causes": [
+				{"error": "test error", "code": "TEST_CODE", "data": "test data"},
+				{"error": "other test error", "code": "OTHER_TEST_CODE"},
+				{"error": "raw error"}
+			]
+		}`, string(data))
+	})
+	suite.Run("joined custom error round trips through json", func() {
+		data, _ := json.Marshal(joinedError)
+		var decoded Error
+		assert.NoError(suite.T(), json.Unmarshal(data, &decoded))
+
+		assert.Equal(suite.T(), JOINED_CODE, decoded.Code)
+		assert.ErrorIs(suite.T(), decoded, NewIsComparable(TEST_CODE))
+		assert.ErrorIs(suite.T(), decoded, NewIsComparable(OTHER_TEST_CODE))
+		assert.Len(suite.T(), decoded.Causes(), 3)
+		assert.Equal(suite.T(), "raw error", decoded.Causes()[2].Error())
+	})
+	suite.Run("plus verb prints the frames of every branch", func() {
+		formatted := fmt.Sprintf("%+v", joinedError)
+		assert.Contains(suite.T(), formatted, "caused by: TEST_CODE: test error")
+		assert.Contains(suite.T(), formatted, "caused by: OTHER_TEST_CODE: other test error")
+		assert.Equal(suite.T(), 3, strings.Count(formatted, "error_test.go"))
+	})
+}
+
+func (suite *ErrorsTestSuite) TestCustomErrorTypedData() {
+
+	type testData struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	const TYPED_TEST_CODE ErrorCode = "TYPED_TEST_CODE"
+	const UNTYPED_TEST_CODE ErrorCode = "UNTYPED_TEST_CODE"
+	registry := NewRegistry().MustRegister(CodeDefinition{Code: TYPED_TEST_CODE, DataType: reflect.TypeFor[testData]()})
+
+	sentinelError := errors.New("test error")
+
+	suite.Run("custom error data is unmarshalled into the registered type", func() {
+		decoded, err := registry.Unmarshal([]byte(`{"error":"test error","code":"TYPED_TEST_CODE","data":{"id":1,"name":"test"}}`))
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), testData{ID: 1, Name: "test"}, decoded.Data)
+	})
+	suite.Run("custom error data of unregistered codes is unmarshalled into generic values", func() {
+		decoded, err := registry.Unmarshal([]byte(`{"error":"test error","code":"UNTYPED_TEST_CODE","data":{"id":1}}`))
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), map[string]any{"id": float64(1)}, decoded.Data)
+	})
+	suite.Run("custom error data not matching the registered type is unmarshalled into generic values", func() {
+		decoded, err := registry.Unmarshal([]byte(`{"error":"test error","code":"TYPED_TEST_CODE","data":{"id":"[REDACTED]","name":"test"}}`))
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), map[string]any{"id": "[REDACTED]", "name": "test"}, decoded.Data)
+	})
+	suite.Run("custom error data of the default registry is unmarshalled into generic values", func() {
+		var decoded Error
+		assert.NoError(suite.T(), json.Unmarshal([]byte(`{"error":"test error","code":"TYPED_TEST_CODE","data":{"id":1}}`), &decoded))
+		assert.Equal(suite.T(), map[string]any{"id": float64(1)}, decoded.Data)
+	})
+	suite.Run("causes data is unmarshalled into the registered type", func() {
+		data, _ := json.Marshal(NewError(errors.Join(NewError(sentinelError, WithCode(TYPED_TEST_CODE), WithData(testData{ID: 2})), sentinelError)))
+		decoded, err := registry.Unmarshal(data)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), testData{ID: 2}, decoded.Causes()[0].(Error).Data)
+	})
+	suite.Run("typed data is accessible through wrapped errors", func() {
+		err := fmt.Errorf("wrapper: %w", NewError(NewError(sentinelError, WithCode(TYPED_TEST_CODE), WithData(testData{ID: 3})), WithCode(UNTYPED_TEST_CODE), WithData("other data")))
+
+		data, ok := DataAs[testData](err)
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), testData{ID: 3}, data)
+
+		text, ok := DataAs[string](err)
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), "other data", text)
+	})
+	suite.Run("typed data is accessible through pointers and joined errors", func() {
+		err := NewError(errors.Join(sentinelError, NewError(sentinelError, WithData(&testData{ID: 4}))))
+
+		data, ok := DataAs[testData](err)
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), testData{ID: 4}, data)
+	})
+	suite.Run("typed data is not found when no custom error carries it", func() {
+		_, ok := DataAs[testData](NewError(sentinelError, WithData("other data")))
+		assert.False(suite.T(), ok)
+		_, ok = DataAs[testData](sentinelError)
+		assert.False(suite.T(), ok)
+	})
+}
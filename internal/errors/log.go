@@ -0,0 +1,73 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+)
+
+func (s Severity) Level() slog.Level { //REVIEW: maps error severities into log levels
+	switch s {
+	case SeverityInfo:
+		return slog.LevelInfo
+	case SeverityWarning:
+		return slog.LevelWarn
+	case SeverityCritical:
+		return slog.LevelError + 4
+	default:
+		return slog.LevelError
+	}
+}
+
+func (he Error) LogValue() slog.Value { //REVIEW: custom error is logged as a structured group, including its cause chain and stack
+	attrs := make([]slog.Attr, 0, 8)
+	if he.Code != "" {
+		attrs = append(attrs, slog.String("code", string(he.Code)))
+	}
+	if he.Message != "" {
+		attrs = append(attrs, slog.String("message", he.Message))
+	}
+	if he.CorrelationID != "" {
+		attrs = append(attrs, slog.String("correlation_id", he.CorrelationID))
+	}
+	if he.RequestID != "" {
+		attrs = append(attrs, slog.String("request_id", he.RequestID))
+	}
+	if he.Class != "" {
+		attrs = append(attrs, slog.String("class", string(he.Class)))
+	}
+	if he.RetryAfter > 0 {
+		attrs = append(attrs, slog.Duration("retry_after", he.RetryAfter))
+	}
+	if he.Err != nil {
+		attrs = append(attrs, slog.String("error", he.Err.Error()))
+	}
+	if he.Data != nil {
+		attrs = append(attrs, slog.Any("data", he.RedactedData(TargetLog)))
+	}
+	if causes := he.Causes(); len(causes) > 0 {
+		causeAttrs := make([]any, 0, len(causes))
+		for i, cause := range causes {
+			causeAttrs = append(causeAttrs, slog.Any(strconv.Itoa(i), logValue(cause)))
+		}
+		attrs = append(attrs, slog.Group("causes", causeAttrs...))
+	} else if cause := (Error{}); errors.As(he.Err, &cause) {
+		attrs = append(attrs, slog.Any("cause", cause))
+	}
+	if frames := he.Frames(); len(frames) > 0 {
+		stack := make([]string, 0, len(frames))
+		for _, frame := range frames {
+			stack = append(stack, fmt.Sprintf("%s %s:%d", frame.Function, frame.File, frame.Line))
+		}
+		attrs = append(attrs, slog.Any("stack", stack))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func logValue(err error) any {
+	if customErr := (Error{}); errors.As(err, &customErr) {
+		return customErr
+	}
+	return err.Error()
+}
@@ -0,0 +1,56 @@
+package errors
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *ErrorsTestSuite) TestCustomErrorLogValue() {
+
+	sentinelError := errors.New("test error")
+	const TEST_CODE ErrorCode = "TEST_CODE"
+	const OTHER_TEST_CODE ErrorCode = "OTHER_TEST_CODE"
+
+	logRecord := func(err error) map[string]any {
+		var buffer bytes.Buffer
+		slog.New(slog.NewJSONHandler(&buffer, nil)).Error("test", slog.Any("error", err))
+		var record map[string]any
+		_ = json.Unmarshal(buffer.Bytes(), &record)
+		return record["error"].(map[string]any)
+	}
+
+	suite.Run("custom error is logged as a structured group", func() {
+		logged := logRecord(NewError(sentinelError, WithCode(TEST_CODE), WithData(map[string]int{"id": 1}), WithMessage("public"), WithCorrelationID("id")))
+
+		assert.Equal(suite.T(), "TEST_CODE", logged["code"])
+		assert.Equal(suite.T(), "public", logged["message"])
+		assert.Equal(suite.T(), "id", logged["correlation_id"])
+		assert.Equal(suite.T(), "test error", logged["error"])
+		assert.Equal(suite.T(), map[string]any{"id": float64(1)}, logged["data"])
+		assert.Len(suite.T(), logged["stack"], 1)
+	})
+	suite.Run("custom error logs its cause chain", func() {
+		logged := logRecord(NewError(NewError(sentinelError, WithCode(OTHER_TEST_CODE)), WithCode(TEST_CODE)))
+
+		cause := logged["cause"].(map[string]any)
+		assert.Equal(suite.T(), "OTHER_TEST_CODE", cause["code"])
+		assert.Equal(suite.T(), "test error", cause["error"])
+	})
+	suite.Run("joined custom error logs every cause", func() {
+		logged := logRecord(NewError(errors.Join(NewError(sentinelError, WithCode(OTHER_TEST_CODE)), sentinelError), WithCode(TEST_CODE)))
+
+		causes := logged["causes"].(map[string]any)
+		assert.Equal(suite.T(), "OTHER_TEST_CODE", causes["0"].(map[string]any)["code"])
+		assert.Equal(suite.T(), "test error", causes["1"])
+	})
+	suite.Run("severities are mapped into log levels", func() {
+		assert.Equal(suite.T(), slog.LevelInfo, SeverityInfo.Level())
+		assert.Equal(suite.T(), slog.LevelWarn, SeverityWarning.Level())
+		assert.Equal(suite.T(), slog.LevelError, SeverityError.Level())
+		assert.Greater(suite.T(), SeverityCritical.Level(), slog.LevelError)
+	})
+}
@@ -0,0 +1,104 @@
+package errors
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type metricKey struct {
+	code        ErrorCode
+	transport   Transport
+	route       string
+	fingerprint string
+}
+
+type fingerprintInfo struct {
+	code     ErrorCode
+	callSite string
+}
+
+type Metrics struct { //REVIEW: observer counting error occurrences, exposed in the prometheus text format so error rates can be alerted on
+	mutex        sync.Mutex
+	counts       map[metricKey]uint64
+	fingerprints map[string]fingerprintInfo
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{counts: make(map[metricKey]uint64), fingerprints: make(map[string]fingerprintInfo)}
+}
+
+func (m *Metrics) Observe(occurrence Occurrence) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.counts[metricKey{occurrence.Code, occurrence.Transport, occurrence.Route, occurrence.Fingerprint}]++
+	m.fingerprints[occurrence.Fingerprint] = fingerprintInfo{occurrence.Code, hashCallSite(occurrence.CallSite)}
+}
+
+func (m *Metrics) Count(code ErrorCode) (count uint64) { //REVIEW: occurrences of the code and its children
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for key, value := range m.counts {
+		if key.code.Within(code) {
+			count += value
+		}
+	}
+	return count
+}
+
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	m.mutex.Lock()
+	counts := make([]string, 0, len(m.counts))
+	for key, value := range m.counts {
+		counts = append(counts, fmt.Sprintf("errors_total{code=%s,transport=%s,route=%s,fingerprint=%s} %d\n",
+			quoteLabel(string(key.code)), quoteLabel(string(key.transport)), quoteLabel(key.route), quoteLabel(key.fingerprint), value))
+	}
+	infos := make([]string, 0, len(m.fingerprints))
+	for fingerprint, info := range m.fingerprints {
+		infos = append(infos, fmt.Sprintf("error_fingerprint_info{fingerprint=%s,code=%s,call_site=%s} 1\n",
+			quoteLabel(fingerprint), quoteLabel(string(info.code)), quoteLabel(info.callSite)))
+	}
+	m.mutex.Unlock()
+	slices.Sort(counts) //REVIEW: stable output eases diffs and tests
+	slices.Sort(infos)
+
+	buffer := bufio.NewWriter(w)
+	buffer.WriteString("# HELP errors_total Errors handled by the transports, by code, route and fingerprint.\n")
+	buffer.WriteString("# TYPE errors_total counter\n")
+	for _, line := range counts {
+		buffer.WriteString(line)
+	}
+	buffer.WriteString("# HELP error_fingerprint_info Code and call site hash of each error fingerprint.\n")
+	buffer.WriteString("# TYPE error_fingerprint_info gauge\n")
+	for _, line := range infos {
+		buffer.WriteString(line)
+	}
+	return buffer.Flush()
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) { //REVIEW: metrics can be scraped from any net/http server or through the fiber adaptor
+	w.Header().Set("Content-Type", PrometheusContentType)
+	_ = m.WritePrometheus(w)
+}
+
+func hashCallSite(callSite string) string { //REVIEW: call sites carry function names and file paths, scrapers only get their hash, the plain call site stays in the error logs
+	if callSite == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(callSite))
+	return hex.EncodeToString(sum[:])[:fingerprintLength]
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
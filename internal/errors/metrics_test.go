@@ -0,0 +1,53 @@
+package errors
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *ErrorsTestSuite) TestMetrics() {
+
+	sentinelError := errors.New("test error")
+	const TEST_CODE ErrorCode = "test.code"
+	newError := func() error { return NewError(sentinelError, WithCode(TEST_CODE)) }
+
+	suite.Run("errors from the same code and call site share the fingerprint", func() {
+		first := NewOccurrence(newError(), TransportHTTP, "GET /")
+		second := NewOccurrence(fmt.Errorf("wrapper: %w", newError()), TransportEvents, "handler")
+		other := NewOccurrence(NewError(sentinelError, WithCode(TEST_CODE)), TransportHTTP, "GET /")
+
+		assert.Equal(suite.T(), TEST_CODE, first.Code)
+		assert.Equal(suite.T(), first.Fingerprint, second.Fingerprint)
+		assert.NotEqual(suite.T(), first.Fingerprint, other.Fingerprint)
+		assert.Contains(suite.T(), first.CallSite, "TestMetrics")
+		assert.Equal(suite.T(), NewOccurrence(sentinelError, TransportHTTP, "").Fingerprint, NewOccurrence(errors.New("other"), TransportHTTP, "").Fingerprint)
+	})
+	suite.Run("observers ignore nil errors and observers", func() {
+		var observed []Occurrence
+		observer := ObserverFunc(func(occurrence Occurrence) { observed = append(observed, occurrence) })
+		Observe(observer, nil, TransportHTTP, "")
+		Observe(nil, sentinelError, TransportHTTP, "")
+		Observe(observer, sentinelError, TransportHTTP, "GET /")
+		assert.Len(suite.T(), observed, 1)
+	})
+	suite.Run("metrics count occurrences and write them in prometheus text format", func() {
+		metrics := NewMetrics()
+		occurrence := NewOccurrence(newError(), TransportHTTP, "GET \"quoted\"")
+		metrics.Observe(occurrence)
+		metrics.Observe(occurrence)
+		metrics.Observe(NewOccurrence(NewError(sentinelError, WithCode("test.other.child")), TransportEvents, "handler"))
+
+		assert.Equal(suite.T(), uint64(3), metrics.Count("test"))
+		assert.Equal(suite.T(), uint64(2), metrics.Count(TEST_CODE))
+
+		var buffer bytes.Buffer
+		assert.NoError(suite.T(), metrics.WritePrometheus(&buffer))
+		assert.Contains(suite.T(), buffer.String(), "# TYPE errors_total counter\n")
+		assert.Contains(suite.T(), buffer.String(), fmt.Sprintf(`errors_total{code="test.code",transport="http",route="GET \"quoted\"",fingerprint="%s"} 2`, occurrence.Fingerprint))
+		assert.Contains(suite.T(), buffer.String(), fmt.Sprintf(`error_fingerprint_info{fingerprint="%s",code="test.code",call_site="%s"} 1`, occurrence.Fingerprint, hashCallSite(occurrence.CallSite)))
+		assert.NotContains(suite.T(), buffer.String(), "TestMetrics")
+	})
+}
@@ -0,0 +1,62 @@
+package errors
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+type Transport string
+
+const (
+	TransportHTTP   Transport = "http"
+	TransportEvents Transport = "events"
+	TransportGRPC   Transport = "grpc"
+)
+
+const fingerprintLength = 16
+
+type Occurrence struct { //REVIEW: a single error handled by a transport, errors from the same code and call site share the fingerprint
+	Code        ErrorCode
+	Transport   Transport
+	Route       string // http route, grpc method or event handler that returned the error
+	CallSite    string
+	Fingerprint string
+	Err         error
+}
+
+func NewOccurrence(err error, transport Transport, route string) Occurrence {
+	occurrence := Occurrence{Transport: transport, Route: route, Err: err}
+	var customErr Error
+	if errors.As(err, &customErr) {
+		occurrence.Code = customErr.Code
+		if frames := customErr.Frames(); len(frames) > 0 {
+			occurrence.CallSite = fmt.Sprintf("%s %s:%d", frames[0].Function, frames[0].File, frames[0].Line)
+		}
+	}
+	site := occurrence.CallSite
+	if site == "" {
+		site = fmt.Sprintf("%T", err) //REVIEW: errors without stack are told apart by their type
+	}
+	sum := sha256.Sum256([]byte(string(occurrence.Code) + "\x00" + site))
+	occurrence.Fingerprint = hex.EncodeToString(sum[:])[:fingerprintLength]
+	return occurrence
+}
+
+type Observer interface { //REVIEW: hook invoked by the error middlewares of every transport, e.g. to count errors or report them to a tracker
+	Observe(occurrence Occurrence)
+}
+
+type ObserverFunc func(occurrence Occurrence)
+
+func (f ObserverFunc) Observe(occurrence Occurrence) {
+	f(occurrence)
+}
+
+func Observe(observer Observer, err error, transport Transport, route string) {
+	if observer == nil || err == nil {
+		return
+	}
+	observer.Observe(NewOccurrence(err, transport, route))
+}
@@ -0,0 +1,171 @@
+package errors
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+type Target string //REVIEW: where error data is written, each target has its own redaction policy
+
+const (
+	TargetResponse Target = "response"
+	TargetLog      Target = "log"
+)
+
+type Action string
+
+const (
+	ActionKeep   Action = ""
+	ActionRedact Action = "redact" // strings are replaced by a placeholder, other values are omitted
+	ActionMask   Action = "mask"   // strings keep only their last characters, other values are omitted
+)
+
+const (
+	redactedPlaceholder = "[REDACTED]"
+	maskVisibleRunes    = 4
+	redactTag           = "redact"
+)
+
+type Redaction struct { //REVIEW: redaction rule of a data field, Field is the dotted json path of the field, slices are traversed transparently
+	Field    string
+	Response Action
+	Log      Action
+}
+
+func (rd Redaction) action(target Target) Action {
+	if target == TargetLog {
+		return rd.Log
+	}
+	return rd.Response
+}
+
+func (r *Registry) Redact(code ErrorCode, data any, target Target) any { //REVIEW: copy of the data, as generic json values, with the struct tag rules and the rules of the code and its ancestors applied
+	if data == nil {
+		return nil
+	}
+	rules := tagRedactions(reflect.TypeOf(data), "", make(map[reflect.Type]bool))
+	for _, ancestor := range code.Ancestors() {
+		if definition, ok := r.Lookup(ancestor); ok {
+			rules = append(rules, definition.Redactions...)
+		}
+	}
+	if len(rules) == 0 {
+		return data
+	}
+	content, err := json.Marshal(data)
+	if err != nil {
+		return redactedPlaceholder //REVIEW: data that cannot be inspected is never written
+	}
+	var tree any
+	_ = json.Unmarshal(content, &tree)
+	for _, rule := range rules {
+		if action := rule.action(target); action != ActionKeep {
+			tree = redactPath(tree, strings.Split(rule.Field, "."), action)
+		}
+	}
+	return tree
+}
+
+func Redact(code ErrorCode, data any, target Target) any {
+	return DefaultRegistry.Redact(code, data, target)
+}
+
+func (he Error) RedactedData(target Target) any {
+	return Redact(he.Code, he.Data, target)
+}
+
+func tagRedactions(dataType reflect.Type, prefix string, visited map[reflect.Type]bool) (rules []Redaction) { //REVIEW: redact:"true" and redact:"mask" apply to every target, redact:"response=true,log=mask" sets each target policy
+	for dataType != nil && (dataType.Kind() == reflect.Pointer || dataType.Kind() == reflect.Slice || dataType.Kind() == reflect.Array) {
+		dataType = dataType.Elem()
+	}
+	if dataType == nil || dataType.Kind() != reflect.Struct || visited[dataType] {
+		return nil
+	}
+	visited[dataType] = true
+	defer delete(visited, dataType)
+
+	for _, field := range reflect.VisibleFields(dataType) {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || field.Anonymous || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		path := prefix + name
+		if tag, ok := field.Tag.Lookup(redactTag); ok {
+			rules = append(rules, parseRedactTag(path, tag))
+			continue
+		}
+		rules = append(rules, tagRedactions(field.Type, path+".", visited)...)
+	}
+	return rules
+}
+
+func parseRedactTag(field string, tag string) Redaction {
+	actions := map[string]Action{"true": ActionRedact, "redact": ActionRedact, "mask": ActionMask}
+	rule := Redaction{Field: field}
+	if action, ok := actions[tag]; ok || !strings.Contains(tag, "=") {
+		rule.Response, rule.Log = action, action
+		return rule
+	}
+	for _, part := range strings.Split(tag, ",") {
+		target, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch Target(target) {
+		case TargetResponse:
+			rule.Response = actions[value]
+		case TargetLog:
+			rule.Log = actions[value]
+		}
+	}
+	return rule
+}
+
+func redactPath(tree any, path []string, action Action) any {
+	switch node := tree.(type) {
+	case []any:
+		for i := range node {
+			node[i] = redactPath(node[i], path, action)
+		}
+	case map[string]any:
+		value, ok := node[path[0]]
+		switch {
+		case !ok:
+		case len(path) > 1:
+			node[path[0]] = redactPath(value, path[1:], action)
+		default:
+			if redacted, keep := redactValue(value, action); keep {
+				node[path[0]] = redacted
+			} else {
+				delete(node, path[0])
+			}
+		}
+	}
+	return tree
+}
+
+func redactValue(value any, action Action) (any, bool) {
+	text, isString := value.(string)
+	switch {
+	case value == nil:
+		return nil, true
+	case !isString:
+		return nil, false
+	case action == ActionMask:
+		return mask(text), true
+	default:
+		return redactedPlaceholder, true
+	}
+}
+
+func mask(text string) string {
+	length := utf8.RuneCountInString(text)
+	if length <= maskVisibleRunes {
+		return strings.Repeat("*", length)
+	}
+	runes := []rune(text)
+	return fmt.Sprintf("%s%s", strings.Repeat("*", length-maskVisibleRunes), string(runes[length-maskVisibleRunes:]))
+}
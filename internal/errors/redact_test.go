@@ -0,0 +1,87 @@
+package errors
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCard struct {
+	Number string `json:"number" redact:"mask"`
+	Holder string `json:"holder"`
+}
+
+type testCustomer struct {
+	Name     string     `json:"name" redact:"response=true,log=mask"`
+	Password string     `json:"password" redact:"true"`
+	Age      int        `json:"age,omitempty" redact:"true"`
+	Email    string     `json:"email"`
+	Cards    []testCard `json:"cards"`
+}
+
+func (suite *ErrorsTestSuite) TestRedaction() {
+
+	sentinelError := errors.New("test error")
+	const TEST_NAMESPACE ErrorCode = "test"
+	const TEST_CHILD_CODE ErrorCode = "test.child"
+
+	registry := NewRegistry().MustRegister(
+		CodeDefinition{Code: TEST_NAMESPACE, Redactions: []Redaction{{Field: "email", Response: ActionMask}}},
+		CodeDefinition{Code: TEST_CHILD_CODE, Redactions: []Redaction{{Field: "cards.holder", Response: ActionRedact, Log: ActionRedact}}},
+	)
+	customer := testCustomer{
+		Name:     "John Doe",
+		Password: "secret",
+		Age:      42,
+		Email:    "john@example.com",
+		Cards:    []testCard{{Number: "4111111111111111", Holder: "John Doe"}},
+	}
+
+	suite.Run("struct tags redact data according to the target", func() {
+		assert.Equal(suite.T(), map[string]any{
+			"name":     "[REDACTED]",
+			"password": "[REDACTED]",
+			"email":    "john@example.com",
+			"cards":    []any{map[string]any{"number": "************1111", "holder": "John Doe"}},
+		}, registry.Redact("other", customer, TargetResponse))
+		assert.Equal(suite.T(), map[string]any{
+			"name":     "**** Doe",
+			"password": "[REDACTED]",
+			"email":    "john@example.com",
+			"cards":    []any{map[string]any{"number": "************1111", "holder": "John Doe"}},
+		}, registry.Redact("other", &customer, TargetLog))
+	})
+	suite.Run("code rules are inherited from ancestors", func() {
+		redacted := registry.Redact(TEST_CHILD_CODE, customer, TargetResponse).(map[string]any)
+		assert.Equal(suite.T(), "************.com", redacted["email"])
+		assert.Equal(suite.T(), []any{map[string]any{"number": "************1111", "holder": "[REDACTED]"}}, redacted["cards"])
+
+		redacted = registry.Redact(TEST_CHILD_CODE, customer, TargetLog).(map[string]any)
+		assert.Equal(suite.T(), "john@example.com", redacted["email"])
+	})
+	suite.Run("data without rules is kept as is", func() {
+		data := map[string]string{"id": "1"}
+		assert.Equal(suite.T(), data, registry.Redact("other", data, TargetResponse))
+		assert.Nil(suite.T(), registry.Redact(TEST_NAMESPACE, nil, TargetResponse))
+	})
+	suite.Run("short strings are fully masked", func() {
+		assert.Equal(suite.T(), "***", mask("abc"))
+		assert.Equal(suite.T(), "**cdef", mask("abcdef"))
+	})
+	suite.Run("json serialization redacts data for responses", func() {
+		content, err := json.Marshal(NewError(sentinelError, WithData(customer)))
+		assert.NoError(suite.T(), err)
+		assert.NotContains(suite.T(), string(content), "secret")
+		assert.NotContains(suite.T(), string(content), "John Doe\",\"password")
+		assert.Contains(suite.T(), string(content), `"number":"************1111"`)
+	})
+	suite.Run("logs redact data for logs", func() {
+		var buffer bytes.Buffer
+		slog.New(slog.NewJSONHandler(&buffer, nil)).Error("failed", "error", NewError(sentinelError, WithData(customer)))
+		assert.NotContains(suite.T(), buffer.String(), "secret")
+		assert.Contains(suite.T(), buffer.String(), `"name":"****`)
+	})
+}
@@ -0,0 +1,163 @@
+package errors
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDuplicateCode    = errors.New("error code already registered")
+	ErrUnregisteredCode = errors.New("error code not registered")
+	ErrDuplicateAlias   = errors.New("error code alias already registered")
+)
+
+type Severity string //REVIEW: severity tells transports how loud an error code should be reported
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityError    Severity = "error"
+	SeverityCritical Severity = "critical"
+)
+
+type CodeDefinition struct { //REVIEW: every error code is declared once with everything transports need to know about it
+	Code       ErrorCode
+	HTTPStatus int
+	Retryable  bool
+	Class      Class
+	RetryAfter time.Duration // default delay before retrying, for retryable classes
+	Severity   Severity
+	Message    string       // default public message
+	DataType   reflect.Type // type carried by Error.Data for this code, nil when the code carries no data
+	Redactions []Redaction  // data fields that must not be written as is, inherited by children codes
+	Aliases    []ErrorCode  // former codes still accepted when decoding errors, responses always carry Code
+}
+
+type Registry struct {
+	mutex       sync.RWMutex
+	definitions map[ErrorCode]CodeDefinition
+	aliases     map[ErrorCode]ErrorCode
+}
+
+func NewRegistry() *Registry {
+	return &Registry{definitions: make(map[ErrorCode]CodeDefinition), aliases: make(map[ErrorCode]ErrorCode)}
+}
+
+var DefaultRegistry = NewRegistry() //REVIEW: project wide registry, codes are registered on it at package initialization
+
+func (r *Registry) Register(definitions ...CodeDefinition) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	seen := make(map[ErrorCode]bool, len(definitions))
+	for _, definition := range definitions { //REVIEW: validates the whole batch first so a failed registration leaves the registry untouched
+		if _, ok := r.definitions[definition.Code]; ok || seen[definition.Code] || r.aliases[definition.Code] != "" {
+			return fmt.Errorf("%w: %v", ErrDuplicateCode, definition.Code)
+		}
+		seen[definition.Code] = true
+	}
+	for _, definition := range definitions {
+		for _, alias := range definition.Aliases {
+			if _, ok := r.definitions[alias]; ok || seen[alias] || r.aliases[alias] != "" {
+				return fmt.Errorf("%w: %v", ErrDuplicateAlias, alias)
+			}
+			seen[alias] = true
+		}
+	}
+	for _, definition := range definitions {
+		if definition.Severity == "" {
+			definition.Severity = SeverityError
+		}
+		r.definitions[definition.Code] = definition
+		for _, alias := range definition.Aliases {
+			r.aliases[alias] = definition.Code
+		}
+	}
+	return nil
+}
+
+func (r *Registry) MustRegister(definitions ...CodeDefinition) *Registry { //REVIEW: panics so duplicated codes break the application at startup
+	if err := r.Register(definitions...); err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func (r *Registry) Lookup(code ErrorCode) (definition CodeDefinition, ok bool) { //REVIEW: aliases resolve to the definition of the code they were renamed to
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	definition, ok = r.definitions[cmp.Or(r.aliases[code], code)]
+	return
+}
+
+func (r *Registry) Canonical(code ErrorCode) ErrorCode { //REVIEW: current code of a former code, any other code is kept as is
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return cmp.Or(r.aliases[code], code)
+}
+
+func (r *Registry) Resolve(code ErrorCode) (definition CodeDefinition, ok bool) { //REVIEW: definition of the code or, when not registered, of its nearest registered ancestor
+	for _, ancestor := range code.Ancestors() {
+		if definition, ok = r.Lookup(ancestor); ok {
+			return
+		}
+	}
+	return
+}
+
+func (r *Registry) HTTPStatus(code ErrorCode) (status int, ok bool) { //REVIEW: status of the code or of its nearest ancestor mapping one
+	for _, ancestor := range code.Ancestors() {
+		if definition, found := r.Lookup(ancestor); found && definition.HTTPStatus != 0 {
+			return definition.HTTPStatus, true
+		}
+	}
+	return
+}
+
+func (r *Registry) Codes() []ErrorCode {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	codes := make([]ErrorCode, 0, len(r.definitions))
+	for code := range r.definitions {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
+
+func (r *Registry) Definition(err error) (definition CodeDefinition, ok bool) { //REVIEW: resolves the definition of the outermost custom error with a code, joined branches are searched in order
+	walk(err, func(err error) bool {
+		customErr, isCustom := asError(err)
+		if !isCustom || customErr.Code == "" {
+			return true
+		}
+		definition, ok = r.Resolve(customErr.Code)
+		return false
+	})
+	return
+}
+
+func (r *Registry) Check(err error) (result error) { //REVIEW: reports codes used in an error tree that were never registered, meant to be used by tests
+	walk(err, func(err error) bool {
+		if customErr, isCustom := asError(err); isCustom && customErr.Code != "" {
+			if _, ok := r.Lookup(customErr.Code); !ok {
+				result = fmt.Errorf("%w: %v", ErrUnregisteredCode, customErr.Code)
+				return false
+			}
+		}
+		return true
+	})
+	return
+}
+
+func Register(definitions ...CodeDefinition) error {
+	return DefaultRegistry.Register(definitions...)
+}
+
+func Lookup(code ErrorCode) (CodeDefinition, bool) {
+	return DefaultRegistry.Lookup(code)
+}
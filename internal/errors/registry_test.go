@@ -0,0 +1,74 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *ErrorsTestSuite) TestRegistry() {
+
+	const TEST_CODE ErrorCode = "TEST_CODE"
+	const OTHER_TEST_CODE ErrorCode = "OTHER_TEST_CODE"
+	const UNREGISTERED_CODE ErrorCode = "UNREGISTERED_CODE"
+
+	newRegistry := func() *Registry {
+		return NewRegistry().MustRegister(
+			CodeDefinition{Code: TEST_CODE, HTTPStatus: 404, Message: "test", DataType: reflect.TypeFor[string]()},
+			CodeDefinition{Code: OTHER_TEST_CODE, HTTPStatus: 409, Retryable: true, Severity: SeverityWarning},
+		)
+	}
+
+	suite.Run("registered codes can be looked up", func() {
+		definition, ok := newRegistry().Lookup(TEST_CODE)
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), 404, definition.HTTPStatus)
+		assert.Equal(suite.T(), SeverityError, definition.Severity)
+		assert.Equal(suite.T(), reflect.TypeFor[string](), definition.DataType)
+	})
+	suite.Run("registered codes are listed in order", func() {
+		assert.Equal(suite.T(), []ErrorCode{OTHER_TEST_CODE, TEST_CODE}, newRegistry().Codes())
+	})
+	suite.Run("registering the same code twice fails", func() {
+		err := newRegistry().Register(CodeDefinition{Code: TEST_CODE})
+		assert.ErrorIs(suite.T(), err, ErrDuplicateCode)
+	})
+	suite.Run("registering the same code twice in a batch fails without registering any", func() {
+		registry := NewRegistry()
+		err := registry.Register(CodeDefinition{Code: TEST_CODE}, CodeDefinition{Code: TEST_CODE})
+		assert.ErrorIs(suite.T(), err, ErrDuplicateCode)
+		assert.Empty(suite.T(), registry.Codes())
+	})
+	suite.Run("must register panics on duplicated codes", func() {
+		assert.Panics(suite.T(), func() { newRegistry().MustRegister(CodeDefinition{Code: OTHER_TEST_CODE}) })
+	})
+	suite.Run("definition is resolved through wrapped errors", func() {
+		err := fmt.Errorf("wrapper: %w", NewError(NewError(errors.New("test error"), WithCode(OTHER_TEST_CODE))))
+		definition, ok := newRegistry().Definition(err)
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), OTHER_TEST_CODE, definition.Code)
+		assert.True(suite.T(), definition.Retryable)
+	})
+	suite.Run("definition is resolved through joined and pointer wrapped errors", func() {
+		pointerErr := NewError(errors.New("test error"), WithCode(OTHER_TEST_CODE))
+		err := fmt.Errorf("wrapper: %w", errors.Join(errors.New("raw error"), &pointerErr))
+		definition, ok := newRegistry().Definition(err)
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), OTHER_TEST_CODE, definition.Code)
+	})
+	suite.Run("check accepts registered codes and raw errors", func() {
+		registry := newRegistry()
+		assert.NoError(suite.T(), registry.Check(NewError(errors.New("test error"), WithCode(TEST_CODE))))
+		assert.NoError(suite.T(), registry.Check(errors.New("test error")))
+	})
+	suite.Run("check detects unregistered codes through wrapped errors", func() {
+		err := fmt.Errorf("wrapper: %w", NewError(NewError(errors.New("test error"), WithCode(UNREGISTERED_CODE)), WithCode(TEST_CODE)))
+		assert.ErrorIs(suite.T(), newRegistry().Check(err), ErrUnregisteredCode)
+	})
+	suite.Run("check detects unregistered codes behind pointers", func() {
+		pointerErr := NewError(errors.New("test error"), WithCode(UNREGISTERED_CODE))
+		assert.ErrorIs(suite.T(), newRegistry().Check(errors.Join(errors.New("raw error"), &pointerErr)), ErrUnregisteredCode)
+	})
+}
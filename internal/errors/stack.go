@@ -0,0 +1,38 @@
+package errors
+
+import (
+	"runtime"
+)
+
+const maxStackDepth = 32
+
+type stack struct {
+	pcs []uintptr
+}
+
+type Frame struct { //REVIEW: resolved call site of an error, serializable for debugging purposes
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+func callers(skip int, pcs []uintptr) []uintptr {
+	n := runtime.Callers(skip+2, pcs) // skips runtime.Callers and callers itself
+	return pcs[:n]
+}
+
+func resolveFrames(pcs []uintptr) []Frame {
+	if len(pcs) == 0 {
+		return nil
+	}
+	result := make([]Frame, 0, len(pcs))
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		result = append(result, Frame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		if !more {
+			break
+		}
+	}
+	return result
+}
@@ -1,24 +1,77 @@
 package events
 
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"runtime"
+	"time"
+)
+
 type Handler func(*ConsumerCtx) error
 type ConsumerCtx struct {
-	handlers []Handler
-	message  []byte
-	values   map[string]any
-	pivot    int
+	ctx         context.Context
+	handlers    []Handler
+	message     []byte
+	envelope    Envelope
+	delivery    *Delivery
+	deadLetters DeadLetterStore
+	attempt     int
+	values      map[string]any
+	pivot       int
 }
 
-func (cc *ConsumerCtx) SetValue(key string, value any) {
+func (cc *ConsumerCtx) Context() context.Context { //REVIEW: done when the consumer stops or the deadline of the message elapses, carries the trace context of the message
+	if cc.ctx == nil {
+		return context.Background()
+	}
+	return cc.ctx
+}
+func (cc *ConsumerCtx) WithContext(ctx context.Context) { //REVIEW: replaces the context seen by the next handlers of the chain, e.g. to add a timeout or values
+	cc.ctx = ctx
+}
+func (cc *ConsumerCtx) SetValue(key string, value any) { //REVIEW: prefer typed keys, see Key
+	if cc.values == nil {
+		cc.values = make(map[string]any)
+	}
 	cc.values[key] = value
 }
 func (cc *ConsumerCtx) GetValue(key string) any {
-	value, ok := cc.values[key]
-	_ = ok
-	return value
+	return cc.values[key]
 }
-func (cc *ConsumerCtx) GetMessage() []byte {
+func (cc *ConsumerCtx) GetMessage() []byte { //REVIEW: the payload of the envelope, or the whole message when it is not an envelope
 	return cc.message
 }
+func (cc *ConsumerCtx) Envelope() Envelope { //REVIEW: id, type, source, time and headers of the message, available before it is parsed
+	return cc.envelope
+}
+func (cc *ConsumerCtx) Header(name string) string {
+	return cc.envelope.Header(name)
+}
+func (cc *ConsumerCtx) Attempt() int { //REVIEW: attempt of the message processing, starting at 1 and incremented by every retry
+	return cc.attempt
+}
+func (cc *ConsumerCtx) Ack() error { //REVIEW: handlers may settle the message themselves, otherwise the consumer settles it by the chain result
+	if cc.delivery == nil {
+		return nil
+	}
+	return cc.delivery.Ack()
+}
+func (cc *ConsumerCtx) Nack() error {
+	if cc.delivery == nil {
+		return nil
+	}
+	return cc.delivery.Nack()
+}
+func (cc *ConsumerCtx) DeadLetter(cause error) error { //REVIEW: stores the message for inspection and re-drive, then acknowledges it so it is not redelivered. Without store the message is only acknowledged
+	if cc.deadLetters != nil && cc.delivery != nil {
+		if err := cc.deadLetters.Add(NewDeadLetter(cc.delivery, cc.HandlerName(), cc.attempt, cause)); err != nil {
+			return fmt.Errorf("error dead-lettering event: %w", err)
+		}
+	}
+	return cc.Ack()
+}
 func (cc *ConsumerCtx) Next() error {
 	if len(cc.handlers) > cc.pivot {
 		cc.pivot++
@@ -26,3 +79,98 @@ func (cc *ConsumerCtx) Next() error {
 	}
 	return nil
 }
+func (cc *ConsumerCtx) branch(handlers []Handler) *ConsumerCtx { //REVIEW: context running another chain on the same message, values are shared with the parent chain
+	return &ConsumerCtx{ctx: cc.ctx, handlers: handlers, message: cc.message, envelope: cc.envelope, delivery: cc.delivery, deadLetters: cc.deadLetters, attempt: cc.attempt, values: cc.values}
+}
+func (cc *ConsumerCtx) HandlerName() string { //REVIEW: name of the last handler of the chain, the one processing the message, or of the route chosen by a Router
+	if route, err := routeHandlerKey.Get(cc); err == nil {
+		return route
+	}
+	return handlerName(cc.handlers)
+}
+
+func handlerName(handlers []Handler) string {
+	if len(handlers) == 0 {
+		return ""
+	}
+	return runtime.FuncForPC(reflect.ValueOf(handlers[len(handlers)-1]).Pointer()).Name()
+}
+
+type TraceContext struct { //REVIEW: w3c trace context, propagated from the producer to the consumer through the envelope headers
+	Parent string
+	State  string
+}
+
+type traceContextKey struct{}
+
+func WithTraceContext(ctx context.Context, trace TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, trace)
+}
+
+func TraceContextFrom(ctx context.Context) (TraceContext, bool) {
+	trace, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return trace, ok && trace.Parent != ""
+}
+
+type correlationIDKey struct{}
+
+func WithCorrelationID(ctx context.Context, id string) context.Context { //REVIEW: id shared by the events produced while handling the same request or message
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+func CorrelationIDFrom(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(correlationIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+func ContextHeaders(ctx context.Context) map[string]string { //REVIEW: envelope headers carrying the deadline, the trace context and the correlation id of the context, nil when it has none of them
+	var headers map[string]string
+	set := func(name, value string) {
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[name] = value
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		set(HeaderDeadline, deadline.UTC().Format(time.RFC3339Nano))
+	}
+	if trace, ok := TraceContextFrom(ctx); ok {
+		set(HeaderTraceParent, trace.Parent)
+		if trace.State != "" {
+			set(HeaderTraceState, trace.State)
+		}
+	}
+	if id, ok := CorrelationIDFrom(ctx); ok {
+		set(HeaderCorrelationID, id)
+	}
+	return headers
+}
+
+func messageContext(parent context.Context, envelope Envelope) (context.Context, context.CancelFunc) { //REVIEW: the consumer context with the deadline, the trace context and the correlation id of the message, invalid deadlines are ignored
+	ctx := parent
+	if id := envelope.Header(HeaderCorrelationID); id != "" {
+		ctx = WithCorrelationID(ctx, id)
+	}
+	if traceParent := envelope.Header(HeaderTraceParent); traceParent != "" {
+		ctx = WithTraceContext(ctx, TraceContext{Parent: traceParent, State: envelope.Header(HeaderTraceState)})
+	}
+	if value := envelope.Header(HeaderDeadline); value != "" {
+		deadline, err := time.Parse(time.RFC3339Nano, value)
+		if err == nil {
+			return context.WithDeadline(ctx, deadline)
+		}
+		slog.Warn("ignoring invalid event deadline", slog.String("id", envelope.ID), slog.String("deadline", value))
+	}
+	return context.WithCancel(ctx)
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
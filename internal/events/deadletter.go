@@ -0,0 +1,211 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	errs "github.com/vfcoelho/go-project-pocs/internal/errors"
+)
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+type DeadLetter struct { //REVIEW: a message that will not succeed by being retried, kept with everything needed to inspect and re-drive it
+	ID         string            `json:"id"`
+	Payload    []byte            `json:"payload,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Error      json.RawMessage   `json:"error"`
+	Handler    string            `json:"handler,omitempty"`
+	Attempts   int               `json:"attempts"`
+	Deliveries int               `json:"deliveries"`
+	FailedAt   time.Time         `json:"failed_at"`
+}
+
+func NewDeadLetter(delivery *Delivery, handler string, attempts int, cause error) DeadLetter {
+	var customErr errs.Error
+	if !errors.As(cause, &customErr) {
+		customErr = errs.NewError(cause)
+	}
+	content, err := json.Marshal(customErr) //REVIEW: the serialized error is redacted as it would be for a caller
+	if err != nil {
+		content, _ = json.Marshal(map[string]string{"error": cause.Error()})
+	}
+	return DeadLetter{
+		ID:         uuid.NewString(),
+		Payload:    delivery.Message,
+		Headers:    delivery.Headers,
+		Error:      content,
+		Handler:    handler,
+		Attempts:   attempts,
+		Deliveries: delivery.Attempt,
+		FailedAt:   time.Now().UTC(),
+	}
+}
+
+type DeadLetterStore interface {
+	Add(letter DeadLetter) error
+	List() ([]DeadLetter, error) // oldest failures first
+	Get(id string) (DeadLetter, error)
+	Remove(id string) error
+}
+
+func Redrive(store DeadLetterStore, transport Transport, id string) error { //REVIEW: sends the original payload back to the main queue, the letter is only removed once the send is confirmed
+	letter, err := store.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := transport.Send(letter.Payload); err != nil {
+		return fmt.Errorf("error re-driving dead letter %s: %w", id, err)
+	}
+	return store.Remove(id)
+}
+
+type MemoryDeadLetterStore struct {
+	mutex   sync.RWMutex
+	letters map[string]DeadLetter
+}
+
+func NewMemoryDeadLetterStore() *MemoryDeadLetterStore {
+	return &MemoryDeadLetterStore{letters: make(map[string]DeadLetter)}
+}
+
+func (ms *MemoryDeadLetterStore) Add(letter DeadLetter) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.letters[letter.ID] = letter
+	return nil
+}
+
+func (ms *MemoryDeadLetterStore) List() ([]DeadLetter, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	letters := make([]DeadLetter, 0, len(ms.letters))
+	for _, letter := range ms.letters {
+		letters = append(letters, letter)
+	}
+	sortDeadLetters(letters)
+	return letters, nil
+}
+
+func (ms *MemoryDeadLetterStore) Get(id string) (DeadLetter, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	letter, ok := ms.letters[id]
+	if !ok {
+		return DeadLetter{}, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+	return letter, nil
+}
+
+func (ms *MemoryDeadLetterStore) Remove(id string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if _, ok := ms.letters[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+	delete(ms.letters, id)
+	return nil
+}
+
+type FileDeadLetterStore struct { //REVIEW: one json file per letter, so the consumer, the api and the cli can share the letters through a directory
+	dir string
+}
+
+func NewFileDeadLetterStore(dir string) (*FileDeadLetterStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileDeadLetterStore{dir: dir}, nil
+}
+
+func (fs *FileDeadLetterStore) path(id string) (string, error) {
+	if _, err := uuid.Parse(id); err != nil { //REVIEW: ids come from callers, they must never escape the directory
+		return "", fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+	return filepath.Join(fs.dir, id+".json"), nil
+}
+
+func (fs *FileDeadLetterStore) Add(letter DeadLetter) error {
+	path, err := fs.path(letter.ID)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(letter, "", "  ")
+	if err != nil {
+		return err
+	}
+	temporary := path + ".tmp"
+	if err := os.WriteFile(temporary, content, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(temporary, path) //REVIEW: letters are never read half written
+}
+
+func (fs *FileDeadLetterStore) List() ([]DeadLetter, error) {
+	entries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return nil, err
+	}
+	var letters []DeadLetter
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		letter, err := fs.Get(id)
+		if errors.Is(err, ErrDeadLetterNotFound) { //REVIEW: removed while listing or not a letter
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, letter)
+	}
+	sortDeadLetters(letters)
+	return letters, nil
+}
+
+func (fs *FileDeadLetterStore) Get(id string) (letter DeadLetter, err error) {
+	path, err := fs.path(id)
+	if err != nil {
+		return
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return letter, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(content, &letter)
+	return
+}
+
+func (fs *FileDeadLetterStore) Remove(id string) error {
+	path, err := fs.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func sortDeadLetters(letters []DeadLetter) {
+	slices.SortFunc(letters, func(a, b DeadLetter) int {
+		if order := a.FailedAt.Compare(b.FailedAt); order != 0 {
+			return order
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+}
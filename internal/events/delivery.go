@@ -0,0 +1,135 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrDeliveryExpired = errors.New("delivery expired") // the visibility timeout elapsed and the message was handed to another delivery
+
+type Delivery struct { //REVIEW: a received message that stays invisible to other receivers until it is acknowledged or its visibility timeout elapses
+	Message  []byte
+	Headers  map[string]string // transport metadata of the message, if any
+	Attempt  int               // 1 on the first delivery, incremented on every redelivery
+	envelope Envelope
+	settle   func(ack bool) error
+	once     sync.Once
+	err      error
+	settled  bool
+}
+
+func NewDelivery(message []byte, attempt int, settle func(ack bool) error) *Delivery { //REVIEW: transports implement acknowledgements through the settle function, it is called at most once
+	return &Delivery{Message: message, Attempt: attempt, settle: settle}
+}
+
+func (d *Delivery) Ack() error { //REVIEW: the message was processed and must not be delivered again
+	return d.finish(true)
+}
+
+func (d *Delivery) Nack() error { //REVIEW: the message was not processed and must be delivered again right away
+	return d.finish(false)
+}
+
+func (d *Delivery) Settled() bool {
+	return d.settled
+}
+
+func (d *Delivery) finish(ack bool) error {
+	d.once.Do(func() {
+		d.settled = true
+		if d.settle != nil {
+			d.err = d.settle(ack)
+		}
+	})
+	return d.err
+}
+
+type queueEntry struct {
+	message  []byte
+	attempts int
+	timer    *time.Timer
+}
+
+type memoryQueue struct { //REVIEW: in memory queue with visibility timeouts, unacknowledged messages are redelivered ahead of new ones
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	size     int
+	timeout  time.Duration
+	ready    []*queueEntry
+	inflight map[uint64]*queueEntry
+	lease    uint64
+	closed   bool
+}
+
+func newMemoryQueue(size int, timeout time.Duration) *memoryQueue {
+	queue := &memoryQueue{size: size, timeout: timeout, inflight: make(map[uint64]*queueEntry)}
+	queue.cond = sync.NewCond(&queue.mutex)
+	return queue
+}
+
+func (q *memoryQueue) push(message []byte) error { //REVIEW: blocks while the queue is full, non positive sizes are unbounded
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for !q.closed && q.size > 0 && len(q.ready)+len(q.inflight) >= q.size {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return ErrTransportClosed
+	}
+	q.ready = append(q.ready, &queueEntry{message: message})
+	q.cond.Broadcast()
+	return nil
+}
+
+func (q *memoryQueue) pop(ctx context.Context) (*Delivery, error) { //REVIEW: blocks until a message is ready, messages ready when closing are still delivered
+	stop := context.AfterFunc(ctx, func() {
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+		q.cond.Broadcast()
+	})
+	defer stop()
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for !q.closed && len(q.ready) == 0 && ctx.Err() == nil {
+		q.cond.Wait()
+	}
+	if err := ctx.Err(); err != nil { //REVIEW: the messages stay in the queue for the next receiver
+		return nil, err
+	}
+	if len(q.ready) == 0 {
+		return nil, ErrTransportClosed
+	}
+	entry := q.ready[0]
+	q.ready = q.ready[1:]
+	entry.attempts++
+	q.lease++
+	lease := q.lease
+	q.inflight[lease] = entry
+	entry.timer = time.AfterFunc(q.timeout, func() { _ = q.settle(lease, false) })
+	return NewDelivery(entry.message, entry.attempts, func(ack bool) error { return q.settle(lease, ack) }), nil
+}
+
+func (q *memoryQueue) settle(lease uint64, ack bool) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	entry, ok := q.inflight[lease]
+	if !ok {
+		return ErrDeliveryExpired
+	}
+	delete(q.inflight, lease)
+	entry.timer.Stop()
+	if !ack {
+		q.ready = append([]*queueEntry{entry}, q.ready...)
+	}
+	q.cond.Broadcast()
+	return nil
+}
+
+func (q *memoryQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
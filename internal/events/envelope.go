@@ -0,0 +1,161 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"mime"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CloudEventsSpecVersion = "1.0"
+	ContentTypeJSON        = "application/json"
+	HeaderCorrelationID    = "correlationid"
+	HeaderDeadline         = "deadline"    // rfc3339 time after which the event is no longer worth processing
+	HeaderTraceParent      = "traceparent" // cloudevents distributed tracing extension
+	HeaderTraceState       = "tracestate"
+)
+
+var (
+	ErrInvalidHeader   = errors.New("invalid header")
+	ErrInvalidEnvelope = errors.New("invalid envelope")
+	headerPattern      = regexp.MustCompile(`^[a-z0-9]{1,20}$`) //REVIEW: headers are cloudevents extension attributes, their names are restricted
+	envelopeAttributes = map[string]bool{"specversion": true, "id": true, "type": true, "source": true, "time": true, "datacontenttype": true, "dataschema": true, "subject": true, "data": true, "data_base64": true}
+)
+
+type Envelope struct { //REVIEW: standard wrapper of every event, its json form is a cloudevents structured mode event
+	ID          string
+	Type        string
+	Source      string
+	Time        time.Time
+	ContentType string
+	DataSchema  string // uri of the payload schema, including its version
+	Headers     map[string]string
+	Payload     []byte
+}
+
+func NewEnvelope(eventType string, source string, payload []byte) Envelope {
+	return Envelope{ID: uuid.NewString(), Type: eventType, Source: source, Time: time.Now().UTC(), ContentType: ContentTypeJSON, Payload: payload}
+}
+
+func ValidateHeader(name string) error {
+	if !headerPattern.MatchString(name) || envelopeAttributes[name] {
+		return fmt.Errorf("%w: %q must be 1 to 20 lowercase letters or digits and not a cloudevents attribute", ErrInvalidHeader, name)
+	}
+	return nil
+}
+
+type envelopeAttributesJSON struct {
+	SpecVersion string          `json:"specversion"`
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Source      string          `json:"source"`
+	Time        *time.Time      `json:"time,omitempty"`
+	ContentType string          `json:"datacontenttype,omitempty"`
+	DataSchema  string          `json:"dataschema,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"`
+	DataBase64  []byte          `json:"data_base64,omitempty"`
+}
+
+func (e Envelope) MarshalJSON() ([]byte, error) {
+	attributes := envelopeAttributesJSON{SpecVersion: CloudEventsSpecVersion, ID: e.ID, Type: e.Type, Source: e.Source, ContentType: e.ContentType, DataSchema: e.DataSchema}
+	if !e.Time.IsZero() {
+		attributes.Time = &e.Time
+	}
+	if isJSONContentType(e.ContentType) && json.Valid(e.Payload) { //REVIEW: json payloads are embedded as is, any other payload is base64 encoded
+		attributes.Data = e.Payload
+	} else if len(e.Payload) > 0 {
+		attributes.DataBase64 = e.Payload
+	}
+	content, err := json.Marshal(attributes)
+	if err != nil || len(e.Headers) == 0 {
+		return content, err
+	}
+
+	members := make(map[string]any)
+	if err := json.Unmarshal(content, &members); err != nil {
+		return nil, err
+	}
+	for name, value := range e.Headers { //REVIEW: headers are flattened as extension attributes
+		if err := ValidateHeader(name); err != nil {
+			return nil, err
+		}
+		members[name] = value
+	}
+	return json.Marshal(members)
+}
+
+func (e *Envelope) UnmarshalJSON(data []byte) error {
+	var attributes envelopeAttributesJSON
+	if err := json.Unmarshal(data, &attributes); err != nil {
+		return err
+	}
+	if attributes.SpecVersion == "" || attributes.ID == "" || attributes.Type == "" {
+		return fmt.Errorf("%w: specversion, id and type are required", ErrInvalidEnvelope)
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	*e = Envelope{ID: attributes.ID, Type: attributes.Type, Source: attributes.Source, ContentType: attributes.ContentType, DataSchema: attributes.DataSchema}
+	if attributes.Time != nil {
+		e.Time = *attributes.Time
+	}
+	e.Payload = attributes.DataBase64
+	if attributes.Data != nil {
+		e.Payload = attributes.Data
+	}
+	for name, raw := range members {
+		var value any
+		if envelopeAttributes[name] || json.Unmarshal(raw, &value) != nil {
+			continue
+		}
+		if e.Headers == nil {
+			e.Headers = make(map[string]string)
+		}
+		if text, ok := value.(string); ok {
+			e.Headers[name] = text
+		} else {
+			e.Headers[name] = string(raw) //REVIEW: cloudevents extensions may be numbers or booleans, they are kept in their json form
+		}
+	}
+	return nil
+}
+
+func ParseEnvelope(message []byte) (envelope Envelope, ok bool) { //REVIEW: messages that are not envelopes, e.g. sent before envelopes existed, are taken as bare payloads
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return Envelope{Payload: message}, false
+	}
+	return envelope, true
+}
+
+func (e Envelope) Header(name string) string {
+	return e.Headers[name]
+}
+
+func (e Envelope) WithHeaders(headers map[string]string) Envelope {
+	if len(headers) == 0 {
+		return e
+	}
+	merged := maps.Clone(e.Headers)
+	if merged == nil {
+		merged = make(map[string]string, len(headers))
+	}
+	maps.Copy(merged, headers)
+	e.Headers = merged
+	return e
+}
+
+func isJSONContentType(contentType string) bool {
+	if contentType == "" {
+		return true //REVIEW: cloudevents consumers assume json when no content type is given
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == ContentTypeJSON || strings.HasSuffix(mediaType, "+json"))
+}
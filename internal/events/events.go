@@ -1,78 +1,268 @@
 package events
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log/slog"
+	"reflect"
 	"sync"
-
-	"github.com/billziss-gh/netchan/netchan"
+	"time"
 )
 
 type Producer[T any] struct {
-	channel   chan []byte
-	waitGroup *sync.WaitGroup
+	transport Transport
+	config    producerConfig
 }
 
-type Consumer[T any] struct {
-	channel chan []byte
+type Consumer struct {
+	transport Transport
+	config    consumerConfig
+	mutex     sync.Mutex
+	done      chan struct{} // closed when the running Consume returns
 }
 
-func NewProducer[T any]() *Producer[T] {
-	wg := &sync.WaitGroup{}
+type ProducerOption func(*producerConfig) //REVIEW: provides with-builder methods to configure producers
+
+type producerConfig struct {
+	transport  Transport
+	source     string
+	eventType  string
+	dataSchema string
+}
 
-	channel := make(chan []byte)
-	wg.Add(1)
+const DefaultSource = "/go-project-pocs"
 
-	errch := make(chan error, 1)
-	err := netchan.Bind("tcp://127.0.0.1/events", channel, errch)
-	if nil != err {
-		panic(err)
+func WithProducerTransport(transport Transport) ProducerOption { //REVIEW: transport used instead of binding the default netchan
+	return func(pc *producerConfig) {
+		pc.transport = transport
 	}
+}
 
-	go func() {
-		for {
-			err = <-errch
-			fmt.Println(err.Error())
+func WithSource(source string) ProducerOption { //REVIEW: source attribute of the produced envelopes, a uri reference identifying the producer
+	return func(pc *producerConfig) {
+		pc.source = source
+	}
+}
+func WithEventType(eventType string) ProducerOption { //REVIEW: type attribute of the produced envelopes, the go type of the events by default. Routed events must set it, go type names change with refactors and would stop matching the routes
+	return func(pc *producerConfig) {
+		pc.eventType = eventType
+	}
+}
+func WithDataSchema(dataSchema string) ProducerOption { //REVIEW: uri of the payload schema, including its version
+	return func(pc *producerConfig) {
+		pc.dataSchema = dataSchema
+	}
+}
+
+type ConsumerOption func(*consumerConfig) //REVIEW: provides with-builder methods to configure consumers
+
+type consumerConfig struct {
+	transport   Transport
+	deadLetters DeadLetterStore
+	maxAttempts int
+	retryDelay  time.Duration
+	concurrency int
+	orderingKey func(message []byte) string
+}
+
+func WithConsumerTransport(transport Transport) ConsumerOption { //REVIEW: transport used instead of exposing the default netchan
+	return func(cc *consumerConfig) {
+		cc.transport = transport
+	}
+}
+func WithDeadLetters(store DeadLetterStore) ConsumerOption { //REVIEW: messages failing for good are stored instead of stopping the consumer
+	return func(cc *consumerConfig) {
+		cc.deadLetters = store
+	}
+}
+func WithConcurrency(concurrency int) ConsumerOption { //REVIEW: messages processed at the same time, 1 processes them one after the other
+	return func(cc *consumerConfig) {
+		cc.concurrency = max(concurrency, 1)
+	}
+}
+func WithOrderingKey[T any](key func(message T) string) ConsumerOption { //REVIEW: messages with the same key are processed in order, one at a time, messages without key or undecodable ones are not ordered
+	return func(cc *consumerConfig) {
+		cc.orderingKey = func(data []byte) string {
+			var message T
+			if json.Unmarshal(data, &message) != nil {
+				return ""
+			}
+			return key(message)
 		}
-	}()
+	}
+}
+func WithMaxAttempts(maxAttempts int) ConsumerOption { //REVIEW: attempts of a message failing with a retryable error before the error stops the consumer, ignored when the chain has a Retry middleware
+	return func(cc *consumerConfig) {
+		cc.maxAttempts = maxAttempts
+	}
+}
+func WithRetryDelay(delay time.Duration) ConsumerOption { //REVIEW: delay between attempts when the error does not define one
+	return func(cc *consumerConfig) {
+		cc.retryDelay = delay
+	}
+}
 
-	return &Producer[T]{
-		channel: channel,
+func NewProducer[T any](opts ...ProducerOption) (*Producer[T], error) {
+	config := producerConfig{source: DefaultSource, eventType: reflect.TypeFor[T]().String()}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if config.transport == nil {
+		transport, err := BindNetchan(DefaultNetchanURI)
+		if err != nil {
+			return nil, err
+		}
+		config.transport = transport
 	}
+	return &Producer[T]{transport: config.transport, config: config}, nil
 }
 
-func NewConsumer[T any]() *Consumer[T] {
-	channel := make(chan []byte)
-	err := netchan.Expose("events", channel) //listener
-	if nil != err {
-		panic(err)
+func NewConsumer(opts ...ConsumerOption) (*Consumer, error) {
+	config := consumerConfig{maxAttempts: 3, retryDelay: time.Second, concurrency: 1}
+	for _, opt := range opts {
+		opt(&config)
 	}
-	return &Consumer[T]{channel: channel}
+	if config.transport == nil {
+		transport, err := ExposeNetchan(DefaultNetchanID)
+		if err != nil {
+			return nil, err
+		}
+		config.transport = transport
+	}
+	return &Consumer{transport: config.transport, config: config}, nil
 }
 
 func (p *Producer[T]) Send(event T) error {
-	data, err := json.Marshal(event)
+	return p.SendWithHeaders(event, nil)
+}
+func (p *Producer[T]) SendContext(ctx context.Context, event T) error { //REVIEW: the deadline and trace context of the context are sent as headers and restored on the consumer context
+	return p.SendWithHeaders(event, ContextHeaders(ctx))
+}
+func (p *Producer[T]) SendWithHeaders(event T, headers map[string]string) error { //REVIEW: the event is sent as the payload of a new envelope
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	envelope := NewEnvelope(p.config.eventType, p.config.source, payload).WithHeaders(headers)
+	envelope.DataSchema = p.config.dataSchema
+	data, err := json.Marshal(envelope)
 	if err != nil {
 		return err
 	}
-	p.channel <- data
-	return nil
+	return p.transport.Send(data)
 }
-func (p *Producer[T]) Close() {
-	close(p.channel)
-	p.waitGroup.Done()
+func (p *Producer[T]) Close() error {
+	return p.transport.Close()
+}
+
+func (c *Consumer) Consume(ctx context.Context, handlers ...Handler) error { //REVIEW: consumes until the context is done or the transport is closed, messages are acknowledged when the chain succeeds and errors not recovered by the handlers are dead-lettered, or stop the consumer when there is no dead letter store
+	done := make(chan struct{})
+	c.mutex.Lock()
+	c.done = done
+	c.mutex.Unlock()
+	defer close(done)
+
+	pool := newWorkerPool(c.config.concurrency, func(delivery *Delivery) error { return c.handle(ctx, delivery, handlers) })
+	err := c.dispatch(ctx, pool)
+	if failure := pool.wait(); failure != nil { //REVIEW: deliveries already dispatched are processed before returning
+		return failure
+	}
+	return err
 }
 
-func (c *Consumer[T]) Consume(handlers ...Handler) error {
+func (c *Consumer) dispatch(ctx context.Context, pool *workerPool) error {
+	receiveCtx, cancel := context.WithCancel(ctx) //REVIEW: a failing worker interrupts the pending receive, the consumer stops without waiting for another message
+	defer cancel()
+	go func() {
+		select {
+		case <-pool.stop:
+			cancel()
+		case <-receiveCtx.Done():
+		}
+	}()
 	for {
-		data := <-c.channel
-		ctx := &ConsumerCtx{message: data, handlers: handlers, values: make(map[string]any)}
-		err := ctx.Next()
+		if !pool.acquire(receiveCtx) {
+			return nil
+		}
+		delivery, err := c.transport.Receive(receiveCtx)
 		if err != nil {
+			pool.release()
+			if errors.Is(err, ErrTransportClosed) || receiveCtx.Err() != nil {
+				return nil
+			}
 			return err
 		}
+		if pool.stopped() { //REVIEW: received while a worker was failing, e.g. the redelivery of the failed message, it is left to the next consumer
+			_ = delivery.Nack()
+			pool.release()
+			return nil
+		}
+		delivery.envelope, _ = ParseEnvelope(delivery.Message)
+		if delivery.Headers == nil {
+			delivery.Headers = delivery.envelope.Headers
+		}
+		var key string
+		if c.config.orderingKey != nil {
+			key = c.config.orderingKey(delivery.envelope.Payload)
+		}
+		pool.dispatch(delivery, key)
+	}
+}
+
+func (c *Consumer) handle(ctx context.Context, delivery *Delivery, handlers []Handler) error { //REVIEW: processes and settles a single delivery, the error is only returned when it must stop the consumer
+	processed, attempts, err := c.process(ctx, delivery, handlers)
+	if err != nil && ctx.Err() != nil { //REVIEW: the message was interrupted by the shutdown, it is redelivered instead of dead-lettered or stopping the consumer
+		_ = delivery.Nack()
+		return nil
+	}
+	if err != nil && !delivery.Settled() && c.config.deadLetters != nil { //REVIEW: errors not recovered by the handlers, e.g. raw errors or exhausted retries, are dead-lettered
+		getLogger(processed).ErrorContext(processed.Context(), "dead-lettering event", slog.Int("attempts", attempts), slog.Any("error", err)) //REVIEW: consumer logs go through the logger of the chain, like the ones of its middlewares
+		if err = c.config.deadLetters.Add(NewDeadLetter(delivery, processed.HandlerName(), attempts, err)); err == nil {
+			err = delivery.Ack()
+		}
+	}
+	switch {
+	case delivery.Settled():
+	case err != nil: //REVIEW: the pool nacks the message once the consumer is stopping, so its redelivery is not dispatched again
+	default:
+		if ackErr := delivery.Ack(); ackErr != nil {
+			getLogger(processed).WarnContext(processed.Context(), "error acknowledging event", slog.Int("attempt", delivery.Attempt), slog.Any("error", ackErr))
+		}
 	}
+	return err
 }
-func (c *Consumer[T]) Close() {
-	close(c.channel)
+
+func (c *Consumer) process(parent context.Context, delivery *Delivery, handlers []Handler) (ctx *ConsumerCtx, attempt int, err error) { //REVIEW: messages failing with retryable errors are processed again instead of stopping the consumer, unless the chain retries them with the Retry middleware
+	messageCtx, cancel := messageContext(parent, delivery.envelope)
+	defer cancel()
+	for attempt = 1; ; attempt++ {
+		ctx = &ConsumerCtx{ctx: messageCtx, message: delivery.envelope.Payload, envelope: delivery.envelope, delivery: delivery, deadLetters: c.config.deadLetters, attempt: attempt, handlers: handlers, values: make(map[string]any)}
+		err = ctx.Next()
+		if retried, retryErr := retryAttemptKey.Get(ctx); retryErr == nil { //REVIEW: the Retry middleware owns the attempt counter, its last attempt is the one reported
+			return ctx, retried, err
+		}
+		registry := getErrorRegistry(ctx) //REVIEW: retries are resolved through the registry set on the chain, the same one used by its middlewares
+		if err == nil || delivery.Settled() || !registry.IsRetryable(err) || attempt >= c.config.maxAttempts {
+			return ctx, attempt, err
+		}
+		delay, ok := registry.RetryAfter(err)
+		if !ok {
+			delay = c.config.retryDelay
+		}
+		getLogger(ctx).WarnContext(messageCtx, "retrying event", slog.Int("attempt", attempt), slog.Duration("delay", delay), slog.Any("error", err))
+		if sleepContext(messageCtx, delay) != nil { //REVIEW: the consumer is stopping, the message is redelivered instead of retried
+			return ctx, attempt, err
+		}
+	}
+}
+func (c *Consumer) Close() error { //REVIEW: closes the transport and waits for the running Consume to drain the messages already received, cancelling the context given to Consume stops it without closing the transport
+	err := c.transport.Close()
+	c.mutex.Lock()
+	done := c.done
+	c.mutex.Unlock()
+	if done != nil {
+		<-done
+	}
+	return err
 }
@@ -0,0 +1,1098 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	errs "github.com/vfcoelho/go-project-pocs/internal/errors"
+)
+
+type EventsTestSuite struct {
+	suite.Suite
+}
+
+func TestEventsTestSuite(t *testing.T) {
+	suite.Run(t, new(EventsTestSuite))
+}
+
+func (suite *EventsTestSuite) skipNetchanUnderRace() { //REVIEW: netchan converts pointers unsafely, checkptr aborts the whole test binary when the race detector is enabled
+	if raceEnabled {
+		suite.T().Skip("netchan is not checkptr safe, run without -race to test it")
+	}
+}
+
+type testEvent struct {
+	ID string `json:"id"`
+}
+
+func (suite *EventsTestSuite) TestTransports() {
+
+	type testCase struct {
+		Producer func() Transport
+		Consumer func() Transport
+	}
+
+	TestCase := func(name string, useCase testCase) (string, func()) {
+		return name, func() {
+			producer, err := NewProducer[testEvent](WithProducerTransport(useCase.Producer()))
+			suite.Require().NoError(err)
+			consumer, err := NewConsumer(WithConsumerTransport(useCase.Consumer()))
+			suite.Require().NoError(err)
+
+			received := make(chan testEvent, 1)
+			done := make(chan error, 1)
+			go func() {
+				done <- consumer.Consume(context.Background(), ParseMessage[testEvent], func(ctx *ConsumerCtx) error {
+					received <- ctx.GetValue("message").(testEvent)
+					return nil
+				})
+			}()
+
+			assert.NoError(suite.T(), producer.Send(testEvent{ID: "1"}))
+			select {
+			case event := <-received:
+				assert.Equal(suite.T(), testEvent{ID: "1"}, event)
+			case <-time.After(5 * time.Second):
+				suite.Fail("event not received")
+			}
+
+			assert.NoError(suite.T(), producer.Close())
+			assert.NoError(suite.T(), consumer.Close())
+			assert.NoError(suite.T(), <-done)
+			assert.ErrorIs(suite.T(), producer.Send(testEvent{}), ErrTransportClosed)
+		}
+	}
+
+	channel := NewChannelTransport(1)
+	suite.Run(TestCase("should run the handler chain on the in-process transport", testCase{
+		Producer: func() Transport { return channel },
+		Consumer: func() Transport { return channel },
+	}))
+	suite.Run(TestCase("should run the handler chain on the netchan transport", testCase{
+		Consumer: func() Transport {
+			suite.skipNetchanUnderRace()
+			transport, err := ExposeNetchan("events-test")
+			suite.Require().NoError(err)
+			return transport
+		},
+		Producer: func() Transport {
+			transport, err := BindNetchan("tcp://127.0.0.1/events-test")
+			suite.Require().NoError(err)
+			return transport
+		},
+	}))
+	dir := suite.T().TempDir()
+	suite.Run(TestCase("should run the handler chain on the file transport", testCase{
+		Producer: func() Transport {
+			transport, err := OpenFileTransport(dir)
+			suite.Require().NoError(err)
+			return transport
+		},
+		Consumer: func() Transport {
+			transport, err := OpenFileTransport(dir, WithPollInterval(time.Millisecond))
+			suite.Require().NoError(err)
+			return transport
+		},
+	}))
+}
+
+func (suite *EventsTestSuite) TestFileTransport() {
+
+	open := func(dir string, opts ...TransportOption) *FileTransport {
+		transport, err := OpenFileTransport(dir, append([]TransportOption{WithPollInterval(time.Millisecond)}, opts...)...)
+		suite.Require().NoError(err)
+		return transport
+	}
+	receive := func(transport Transport) *Delivery {
+		delivery, err := transport.Receive(context.Background())
+		suite.Require().NoError(err)
+		return delivery
+	}
+	segments := func(dir string) []string {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*"+walSegmentExt))
+		return paths
+	}
+
+	suite.Run("should resume from the acknowledged offset after a restart", func() {
+		dir := suite.T().TempDir()
+		producer := open(dir)
+		for _, message := range []string{"first", "second", "third"} {
+			suite.Require().NoError(producer.Send([]byte(message)))
+		}
+		suite.Require().NoError(producer.Close())
+
+		consumer := open(dir)
+		assert.NoError(suite.T(), receive(consumer).Ack())
+		_ = receive(consumer)
+		assert.NoError(suite.T(), receive(consumer).Ack()) //REVIEW: acknowledged out of order, it is delivered again after the restart
+		assert.NoError(suite.T(), consumer.Close())
+
+		consumer = open(dir)
+		defer consumer.Close()
+		assert.Equal(suite.T(), []byte("second"), receive(consumer).Message)
+		assert.Equal(suite.T(), []byte("third"), receive(consumer).Message)
+	})
+	suite.Run("should redeliver nacked messages before new ones", func() {
+		dir := suite.T().TempDir()
+		transport := open(dir)
+		defer transport.Close()
+		_ = transport.Send([]byte("first"))
+		_ = transport.Send([]byte("second"))
+		assert.NoError(suite.T(), receive(transport).Nack())
+
+		delivery := receive(transport)
+		assert.Equal(suite.T(), []byte("first"), delivery.Message)
+		assert.Equal(suite.T(), 2, delivery.Attempt)
+	})
+	suite.Run("should roll segments and remove the consumed ones", func() {
+		dir := suite.T().TempDir()
+		transport := open(dir, WithSegmentSize(40))
+		defer transport.Close()
+		for i := range 5 {
+			suite.Require().NoError(transport.Send([]byte("message " + strconv.Itoa(i))))
+		}
+		assert.Len(suite.T(), segments(dir), 3)
+
+		for i := range 5 {
+			delivery := receive(transport)
+			assert.Equal(suite.T(), []byte("message "+strconv.Itoa(i)), delivery.Message)
+			assert.NoError(suite.T(), delivery.Ack())
+		}
+		assert.Len(suite.T(), segments(dir), 1, "the active segment is always kept")
+	})
+	suite.Run("should remove unconsumed segments past the retention", func() {
+		dir := suite.T().TempDir()
+		producer := open(dir, WithSegmentSize(40), WithRetention(time.Hour))
+		for i := range 5 {
+			suite.Require().NoError(producer.Send([]byte("message " + strconv.Itoa(i))))
+		}
+		old := time.Now().Add(-2 * time.Hour)
+		_ = os.Chtimes(segments(dir)[0], old, old)
+		assert.NoError(suite.T(), producer.Compact())
+		_ = producer.Close()
+
+		consumer := open(dir)
+		defer consumer.Close()
+		assert.Len(suite.T(), segments(dir), 2)
+		assert.Equal(suite.T(), []byte("message 2"), receive(consumer).Message)
+	})
+	suite.Run("should drop torn records and skip corrupt ones", func() {
+		dir := suite.T().TempDir()
+		producer := open(dir, WithSegmentSize(40))
+		_ = producer.Send([]byte("message 0"))
+		_ = producer.Send([]byte("message 1"))
+		_ = producer.Send([]byte("message 2"))
+		_ = producer.Close()
+
+		paths := segments(dir)
+		content, _ := os.ReadFile(paths[0])
+		content[len(content)-1] ^= 0xff //REVIEW: flips a payload bit of the sealed segment, the checksum no longer matches
+		_ = os.WriteFile(paths[0], content, 0o644)
+		active, _ := os.OpenFile(paths[len(paths)-1], os.O_APPEND|os.O_WRONLY, 0o644)
+		_, _ = active.Write([]byte{0, 0, 0, 9, 1, 2}) //REVIEW: a record torn by a crash
+		_ = active.Close()
+
+		producer = open(dir, WithSegmentSize(40))
+		assert.NoError(suite.T(), producer.Send([]byte("message 3")))
+		_ = producer.Close()
+
+		consumer := open(dir)
+		defer consumer.Close()
+		for _, want := range []string{"message 0", "message 2", "message 3"} {
+			assert.Equal(suite.T(), []byte(want), receive(consumer).Message)
+		}
+	})
+	suite.Run("should read a record completed before its segment was rolled", func() {
+		dir := suite.T().TempDir()
+		transport := open(dir)
+		defer transport.Close()
+		suite.Require().NoError(transport.Send([]byte("message 0")))
+		assert.NoError(suite.T(), receive(transport).Ack())
+
+		message := []byte("message 1")
+		record := make([]byte, walHeaderSize+len(message))
+		binary.BigEndian.PutUint32(record[:4], uint32(len(message)))
+		binary.BigEndian.PutUint32(record[4:walHeaderSize], crc32.Checksum(message, walTable))
+		copy(record[walHeaderSize:], message)
+		active, _ := os.OpenFile(segments(dir)[0], os.O_APPEND|os.O_WRONLY, 0o644)
+		defer active.Close()
+		_, _ = active.Write(record[:walHeaderSize+2]) //REVIEW: the reader polls while another process is appending the record
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := transport.Receive(ctx)
+		suite.Require().ErrorIs(err, context.DeadlineExceeded)
+
+		_, _ = active.Write(record[walHeaderSize+2:]) //REVIEW: the append completes and the next one rolls the segment before the reader resumes
+		info, _ := active.Stat()
+		_ = os.WriteFile(transport.segmentPath(info.Size()), nil, 0o644)
+
+		assert.Equal(suite.T(), message, receive(transport).Message)
+	})
+	suite.Run("should receive messages sent by another transport on the same directory", func() {
+		dir := suite.T().TempDir()
+		consumer := open(dir)
+		defer consumer.Close()
+		received := make(chan []byte, 1)
+		go func() {
+			delivery, err := consumer.Receive(context.Background())
+			if err == nil {
+				received <- delivery.Message
+			}
+		}()
+
+		producer := open(dir)
+		defer producer.Close()
+		assert.NoError(suite.T(), producer.Send([]byte("message")))
+		select {
+		case message := <-received:
+			assert.Equal(suite.T(), []byte("message"), message)
+		case <-time.After(time.Second):
+			suite.Fail("message not received")
+		}
+	})
+	suite.Run("should let a single transport receive from the log", func() {
+		dir := suite.T().TempDir()
+		first, second := open(dir), open(dir)
+		defer second.Close()
+		assert.NoError(suite.T(), second.Send([]byte("message")))
+
+		delivery, err := first.Receive(context.Background())
+		suite.Require().NoError(err)
+		_, err = second.Receive(context.Background())
+		assert.ErrorIs(suite.T(), err, ErrReceiverLocked)
+
+		assert.NoError(suite.T(), first.Close())
+		delivery, err = second.Receive(context.Background())
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), []byte("message"), delivery.Message, "messages not acknowledged by the closed receiver are delivered again")
+	})
+}
+
+func (suite *EventsTestSuite) TestChannelTransport() {
+
+	suite.Run("should deliver messages sent before closing", func() {
+		transport := NewChannelTransport(2)
+		assert.NoError(suite.T(), transport.Send([]byte("first")))
+		assert.NoError(suite.T(), transport.Close())
+
+		delivery, err := transport.Receive(context.Background())
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), []byte("first"), delivery.Message)
+		_, err = transport.Receive(context.Background())
+		assert.ErrorIs(suite.T(), err, ErrTransportClosed)
+	})
+	suite.Run("should reject the wrong direction on netchan ends", func() {
+		suite.skipNetchanUnderRace()
+		transport, err := ExposeNetchan("events-direction-test")
+		suite.Require().NoError(err)
+		defer transport.Close()
+		assert.ErrorIs(suite.T(), transport.Send(nil), errors.ErrUnsupported)
+	})
+}
+
+func (suite *EventsTestSuite) TestAcknowledgements() {
+
+	receive := func(transport Transport) *Delivery {
+		delivery, err := transport.Receive(context.Background())
+		suite.Require().NoError(err)
+		return delivery
+	}
+
+	suite.Run("should not redeliver acknowledged messages", func() {
+		transport := NewChannelTransport(0)
+		_ = transport.Send([]byte("message"))
+		delivery := receive(transport)
+		assert.NoError(suite.T(), delivery.Ack())
+		assert.NoError(suite.T(), delivery.Nack()) //REVIEW: settling twice is a no-op
+		_ = transport.Close()
+
+		_, err := transport.Receive(context.Background())
+		assert.ErrorIs(suite.T(), err, ErrTransportClosed)
+	})
+	suite.Run("should redeliver nacked messages before new ones", func() {
+		transport := NewChannelTransport(0)
+		_ = transport.Send([]byte("first"))
+		_ = transport.Send([]byte("second"))
+		assert.NoError(suite.T(), receive(transport).Nack())
+
+		delivery := receive(transport)
+		assert.Equal(suite.T(), []byte("first"), delivery.Message)
+		assert.Equal(suite.T(), 2, delivery.Attempt)
+	})
+	suite.Run("should redeliver messages after the visibility timeout", func() {
+		transport := NewChannelTransport(0, WithVisibilityTimeout(10*time.Millisecond))
+		_ = transport.Send([]byte("message"))
+		expired := receive(transport)
+
+		delivery := receive(transport)
+		assert.Equal(suite.T(), 2, delivery.Attempt)
+		assert.ErrorIs(suite.T(), expired.Ack(), ErrDeliveryExpired)
+		assert.NoError(suite.T(), delivery.Ack())
+	})
+	suite.Run("should nack the message when an error stops the consumer", func() {
+		transport := NewChannelTransport(0)
+		consumer, _ := NewConsumer(WithConsumerTransport(transport))
+		_ = transport.Send([]byte(`{"id": "1"}`))
+
+		err := consumer.Consume(context.Background(), func(ctx *ConsumerCtx) error { return errors.New("database down") })
+		assert.EqualError(suite.T(), err, "database down")
+		assert.Equal(suite.T(), 2, receive(transport).Attempt)
+	})
+	suite.Run("should let handlers settle the message", func() {
+		transport := NewChannelTransport(0)
+		consumer, _ := NewConsumer(WithConsumerTransport(transport))
+		_ = transport.Send([]byte(`{"id": "1"}`))
+		_ = transport.Send([]byte(`{"id": "2"}`))
+
+		err := consumer.Consume(context.Background(), func(ctx *ConsumerCtx) error {
+			_ = ctx.Ack()
+			return errors.New("failed after acknowledging")
+		})
+		assert.Error(suite.T(), err)
+		assert.Equal(suite.T(), []byte(`{"id": "2"}`), receive(transport).Message)
+	})
+	suite.Run("should fail sending when the netchan receiver does not confirm", func() {
+		suite.skipNetchanUnderRace()
+		transport, err := BindNetchan("tcp://127.0.0.1/events-unconfirmed-test", WithConfirmTimeout(50*time.Millisecond))
+		suite.Require().NoError(err)
+		defer transport.Close()
+		assert.ErrorIs(suite.T(), transport.Send([]byte("message")), ErrNotConfirmed)
+	})
+	suite.Run("should keep the messages confirmed by netchan in its inbox", func() {
+		suite.skipNetchanUnderRace()
+		dir := suite.T().TempDir()
+		receiver, err := ExposeNetchan("events-inbox-test", WithInboxDir(dir))
+		suite.Require().NoError(err)
+		sender, err := BindNetchan("tcp://127.0.0.1/events-inbox-test")
+		suite.Require().NoError(err)
+		defer sender.Close()
+
+		suite.Require().NoError(sender.Send([]byte("message")))
+		assert.NoError(suite.T(), receiver.Close()) //REVIEW: the receiving process stops before the message is received
+
+		inbox, err := OpenFileTransport(dir)
+		suite.Require().NoError(err)
+		defer inbox.Close()
+		assert.Equal(suite.T(), []byte("message"), receive(inbox).Message)
+	})
+	suite.Run("should stop sending on netchan when the transport is closed", func() {
+		suite.skipNetchanUnderRace()
+		transport, err := BindNetchan("tcp://127.0.0.1/events-closed-test", WithConfirmTimeout(time.Minute))
+		suite.Require().NoError(err)
+		sent := make(chan error, 1)
+		go func() { sent <- transport.Send([]byte("message")) }()
+		time.Sleep(50 * time.Millisecond)
+
+		closed := make(chan error, 1)
+		go func() { closed <- transport.Close() }()
+		select {
+		case err := <-closed:
+			assert.NoError(suite.T(), err)
+			assert.ErrorIs(suite.T(), <-sent, ErrTransportClosed)
+		case <-time.After(5 * time.Second):
+			suite.Fail("close blocked by a pending send")
+		}
+	})
+}
+
+func (suite *EventsTestSuite) TestDeadLetters() {
+
+	permanentErr := errs.NewError(errors.New("invalid record"), errs.WithClass(errs.ClassPermanent))
+	consume := func(store DeadLetterStore, handlers ...Handler) (*ChannelTransport, error) {
+		transport := NewChannelTransport(0)
+		consumer, _ := NewConsumer(WithConsumerTransport(transport), WithDeadLetters(store), WithMaxAttempts(2), WithRetryDelay(time.Millisecond))
+		_ = transport.Send([]byte(`{"id": "1"}`))
+		_ = transport.Close()
+		return transport, consumer.Consume(context.Background(), handlers...)
+	}
+	logger := SetLogger(slog.New(slog.NewJSONHandler(io.Discard, nil)))
+
+	suite.Run("should dead-letter permanent errors recovered by ErrorRecover", func() {
+		store := NewMemoryDeadLetterStore()
+		_, err := consume(store, ErrorRecover, logger, func(ctx *ConsumerCtx) error { return permanentErr })
+
+		letters, _ := store.List()
+		assert.NoError(suite.T(), err)
+		suite.Require().Len(letters, 1)
+		assert.Equal(suite.T(), []byte(`{"id": "1"}`), letters[0].Payload)
+		assert.Equal(suite.T(), 1, letters[0].Attempts)
+		assert.Contains(suite.T(), string(letters[0].Error), `"error":"invalid record"`)
+	})
+	suite.Run("should dead-letter exhausted retries and raw errors instead of stopping", func() {
+		store := NewMemoryDeadLetterStore()
+		transientErr := errs.NewError(errors.New("database down"), errs.WithClass(errs.ClassTransient))
+		transport, err := consume(store, ErrorRecover, logger, func(ctx *ConsumerCtx) error { return transientErr })
+
+		letters, _ := store.List()
+		assert.NoError(suite.T(), err)
+		suite.Require().Len(letters, 1)
+		assert.Equal(suite.T(), 2, letters[0].Attempts)
+		assert.Equal(suite.T(), 1, letters[0].Deliveries)
+		_, err = transport.Receive(context.Background())
+		assert.ErrorIs(suite.T(), err, ErrTransportClosed) //REVIEW: dead-lettered messages are acknowledged
+
+		_, err = consume(store, func(ctx *ConsumerCtx) error { return errors.New("raw error") })
+		letters, _ = store.List()
+		assert.NoError(suite.T(), err)
+		assert.Len(suite.T(), letters, 2)
+	})
+	suite.Run("should resolve retries through the registry of the chain", func() {
+		const TEST_CODE errs.ErrorCode = "events.retryable"
+		registry := errs.NewRegistry().MustRegister(errs.CodeDefinition{Code: TEST_CODE, Class: errs.ClassTransient})
+		store := NewMemoryDeadLetterStore()
+		_, err := consume(store, SetErrorRegistry(registry), logger, func(ctx *ConsumerCtx) error {
+			return errs.NewError(errors.New("database down"), errs.WithCode(TEST_CODE))
+		})
+
+		letters, _ := store.List()
+		assert.NoError(suite.T(), err)
+		suite.Require().Len(letters, 1)
+		assert.Equal(suite.T(), 2, letters[0].Attempts)
+	})
+	suite.Run("should log retries and dead letters with the logger of the chain", func() {
+		var buffer bytes.Buffer
+		transientErr := errs.NewError(errors.New("database down"), errs.WithClass(errs.ClassTransient))
+		_, err := consume(NewMemoryDeadLetterStore(), SetLogger(slog.New(slog.NewJSONHandler(&buffer, nil))), func(ctx *ConsumerCtx) error { return transientErr })
+
+		assert.NoError(suite.T(), err)
+		assert.Contains(suite.T(), buffer.String(), `"msg":"retrying event"`)
+		assert.Contains(suite.T(), buffer.String(), `"msg":"dead-lettering event"`)
+	})
+	suite.Run("should leave retries to the Retry middleware when the chain has one", func() {
+		calls := 0
+		transientErr := errs.NewError(errors.New("database down"), errs.WithClass(errs.ClassTransient))
+		retry := Retry(WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: ConstantBackoff(time.Millisecond)}))
+
+		_, err := consume(nil, logger, retry, func(ctx *ConsumerCtx) error { calls++; return transientErr })
+		assert.ErrorIs(suite.T(), err, transientErr)
+		assert.Equal(suite.T(), 3, calls)
+
+		calls = 0
+		store := NewMemoryDeadLetterStore()
+		router := NewRouter().Handle("", retry, func(ctx *ConsumerCtx) error { calls++; return transientErr }) //REVIEW: bare payloads have no type
+		_, err = consume(store, logger, router.Dispatch)
+		letters, _ := store.List()
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), 3, calls)
+		suite.Require().Len(letters, 1)
+		assert.Equal(suite.T(), 3, letters[0].Attempts)
+	})
+	suite.Run("should store letters on disk and re-drive them", func() {
+		store, err := NewFileDeadLetterStore(suite.T().TempDir())
+		suite.Require().NoError(err)
+		letter := NewDeadLetter(&Delivery{Message: []byte("message"), Headers: map[string]string{"source": "test"}, Attempt: 2}, "handler", 3, permanentErr)
+		suite.Require().NoError(store.Add(letter))
+
+		stored, err := store.Get(letter.ID)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), letter.Headers, stored.Headers)
+		assert.Equal(suite.T(), letter.FailedAt, stored.FailedAt)
+		_, err = store.Get("../escape")
+		assert.ErrorIs(suite.T(), err, ErrDeadLetterNotFound)
+
+		transport := NewChannelTransport(0)
+		assert.NoError(suite.T(), Redrive(store, transport, letter.ID))
+		delivery, _ := transport.Receive(context.Background())
+		assert.Equal(suite.T(), []byte("message"), delivery.Message)
+		assert.ErrorIs(suite.T(), Redrive(store, transport, letter.ID), ErrDeadLetterNotFound)
+	})
+}
+
+func (suite *EventsTestSuite) TestRetry() {
+
+	const TEST_CODE errs.ErrorCode = "events.test"
+	registry := errs.NewRegistry().MustRegister(errs.CodeDefinition{Code: TEST_CODE, Class: errs.ClassPermanent})
+	transientErr := errs.NewError(errors.New("database down"), errs.WithClass(errs.ClassTransient))
+	permanentErr := errs.NewError(errors.New("invalid record"), errs.WithCode(TEST_CODE+".child"))
+
+	type testCase struct {
+		Options      []RetryOption
+		Err          error
+		FailAttempts int
+		WantAttempts []int
+		WantDelays   []time.Duration
+		WantLetters  int
+		WantErr      error
+	}
+
+	TestCase := func(name string, useCase testCase) (string, func()) {
+		return name, func() {
+			var delays []time.Duration
+			sleep := RetryOption(func(rc *retryConfig) {
+				rc.sleep = func(_ context.Context, delay time.Duration) error { delays = append(delays, delay); return nil }
+			})
+			store := NewMemoryDeadLetterStore()
+			var attempts []int
+			ctx := &ConsumerCtx{delivery: NewDelivery(nil, 1, nil), deadLetters: store, values: make(map[string]any), handlers: []Handler{
+				SetErrorRegistry(registry),
+				SetLogger(slog.New(slog.NewJSONHandler(io.Discard, nil))),
+				Retry(append(useCase.Options, sleep)...),
+				func(ctx *ConsumerCtx) error {
+					attempts = append(attempts, ctx.Attempt())
+					if ctx.Attempt() <= useCase.FailAttempts {
+						return useCase.Err
+					}
+					return nil
+				},
+			}}
+
+			err := ctx.Next()
+			letters, _ := store.List()
+
+			assert.Equal(suite.T(), useCase.WantErr, err)
+			assert.Equal(suite.T(), useCase.WantAttempts, attempts)
+			assert.Equal(suite.T(), useCase.WantDelays, delays)
+			assert.Len(suite.T(), letters, useCase.WantLetters)
+		}
+	}
+
+	exponential := RetryPolicy{MaxAttempts: 4, Backoff: ExponentialBackoff(10*time.Millisecond, 2, 25*time.Millisecond)}
+	suite.Run(TestCase("should retry retryable errors with the backoff curve", testCase{
+		Options:      []RetryOption{WithRetryPolicy(exponential)},
+		Err:          transientErr,
+		FailAttempts: 3,
+		WantAttempts: []int{1, 2, 3, 4},
+		WantDelays:   []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 25 * time.Millisecond},
+	}))
+	suite.Run(TestCase("should dead-letter exhausted retries", testCase{
+		Options:      []RetryOption{WithRetryPolicy(RetryPolicy{MaxAttempts: 2, Backoff: ConstantBackoff(time.Millisecond)})},
+		Err:          transientErr,
+		FailAttempts: 5,
+		WantAttempts: []int{1, 2},
+		WantDelays:   []time.Duration{time.Millisecond},
+		WantLetters:  1,
+	}))
+	suite.Run(TestCase("should stop retrying when the max elapsed time would be exceeded", testCase{
+		Options:      []RetryOption{WithRetryPolicy(RetryPolicy{MaxAttempts: 10, Backoff: ConstantBackoff(time.Hour), MaxElapsed: time.Minute})},
+		Err:          transientErr,
+		FailAttempts: 5,
+		WantAttempts: []int{1},
+		WantLetters:  1,
+	}))
+	suite.Run(TestCase("should not retry errors without policy", testCase{
+		Err:          permanentErr,
+		FailAttempts: 5,
+		WantAttempts: []int{1},
+		WantErr:      permanentErr,
+	}))
+	suite.Run(TestCase("should apply the policy of the nearest code", testCase{
+		Options:      []RetryOption{WithCodeRetryPolicy(TEST_CODE, RetryPolicy{MaxAttempts: 3, Backoff: ConstantBackoff(time.Second)})},
+		Err:          permanentErr,
+		FailAttempts: 1,
+		WantAttempts: []int{1, 2},
+		WantDelays:   []time.Duration{time.Second},
+	}))
+	suite.Run("should keep delays within the jitter", func() {
+		policy := RetryPolicy{Backoff: ConstantBackoff(time.Second), Jitter: 0.5}
+		for range 20 {
+			delay := policy.delay(1, transientErr, registry)
+			assert.GreaterOrEqual(suite.T(), delay, 500*time.Millisecond)
+			assert.LessOrEqual(suite.T(), delay, time.Second)
+		}
+		assert.Equal(suite.T(), time.Minute, policy.delay(1, errs.NewError(transientErr, errs.WithRetryAfter(time.Minute)), registry))
+	})
+}
+
+func (suite *EventsTestSuite) TestConcurrency() {
+
+	send := func(transport Transport, events ...testEvent) {
+		for _, event := range events {
+			data, _ := json.Marshal(event)
+			_ = transport.Send(data)
+		}
+	}
+
+	suite.Run("should process messages in parallel up to the concurrency", func() {
+		transport := NewChannelTransport(0)
+		consumer, _ := NewConsumer(WithConsumerTransport(transport), WithConcurrency(3))
+		send(transport, testEvent{ID: "1"}, testEvent{ID: "2"}, testEvent{ID: "3"}, testEvent{ID: "4"})
+
+		var running atomic.Int32
+		var exceeded atomic.Bool
+		release := make(chan struct{})
+		done := make(chan error, 1)
+		go func() {
+			done <- consumer.Consume(context.Background(), func(ctx *ConsumerCtx) error {
+				if running.Add(1) > 3 {
+					exceeded.Store(true)
+				}
+				<-release
+				running.Add(-1)
+				return nil
+			})
+		}()
+		assert.Eventually(suite.T(), func() bool { return running.Load() == 3 }, time.Second, time.Millisecond)
+		close(release)
+		assert.NoError(suite.T(), consumer.Close())
+		assert.NoError(suite.T(), <-done)
+		assert.False(suite.T(), exceeded.Load())
+	})
+	suite.Run("should keep the order of messages with the same key", func() {
+		transport := NewChannelTransport(0)
+		consumer, _ := NewConsumer(WithConsumerTransport(transport), WithConcurrency(4), WithOrderingKey(func(event testEvent) string { return event.ID[:1] }))
+		for i := range 20 {
+			send(transport, testEvent{ID: fmt.Sprintf("%c%02d", 'a'+i%3, i)})
+		}
+		_ = transport.Close()
+
+		var mutex sync.Mutex
+		processed := make(map[string][]string)
+		err := consumer.Consume(context.Background(), ParseMessage[testEvent], func(ctx *ConsumerCtx) error {
+			event := ctx.GetValue("message").(testEvent)
+			time.Sleep(time.Duration(rand.IntN(3)) * time.Millisecond)
+			mutex.Lock()
+			defer mutex.Unlock()
+			processed[event.ID[:1]] = append(processed[event.ID[:1]], event.ID)
+			return nil
+		})
+
+		assert.NoError(suite.T(), err)
+		for key, ids := range processed {
+			assert.True(suite.T(), slices.IsSorted(ids), key)
+		}
+		assert.Len(suite.T(), processed["a"], 7)
+	})
+	suite.Run("should drain the messages being processed on close", func() {
+		transport := NewChannelTransport(0)
+		consumer, _ := NewConsumer(WithConsumerTransport(transport), WithConcurrency(2))
+		send(transport, testEvent{ID: "1"}, testEvent{ID: "2"})
+
+		var processed atomic.Int32
+		started := make(chan struct{}, 2)
+		go func() {
+			_ = consumer.Consume(context.Background(), func(ctx *ConsumerCtx) error {
+				started <- struct{}{}
+				time.Sleep(20 * time.Millisecond)
+				processed.Add(1)
+				return nil
+			})
+		}()
+		<-started
+		<-started
+		assert.NoError(suite.T(), consumer.Close())
+		assert.Equal(suite.T(), int32(2), processed.Load())
+	})
+	suite.Run("should stop every worker when one fails", func() {
+		transport := NewChannelTransport(0)
+		consumer, _ := NewConsumer(WithConsumerTransport(transport), WithConcurrency(2))
+		send(transport, testEvent{ID: "1"})
+
+		err := consumer.Consume(context.Background(), func(ctx *ConsumerCtx) error { return errors.New("database down") })
+		assert.EqualError(suite.T(), err, "database down")
+	})
+	consumeFailing := func(transport Transport, handler Handler) error {
+		consumer, _ := NewConsumer(WithConsumerTransport(transport), WithConcurrency(2))
+		done := make(chan error, 1)
+		go func() { done <- consumer.Consume(context.Background(), handler) }()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(time.Second):
+			suite.FailNow("consumer did not stop after the failure")
+			return nil
+		}
+	}
+	suite.Run("should not handle the failed message again while stopping", func() {
+		transport := NewChannelTransport(0)
+		send(transport, testEvent{ID: "1"})
+
+		var handled atomic.Int32
+		err := consumeFailing(transport, func(ctx *ConsumerCtx) error {
+			handled.Add(1)
+			time.Sleep(20 * time.Millisecond)
+			return errors.New("database down")
+		})
+
+		assert.EqualError(suite.T(), err, "database down")
+		assert.Equal(suite.T(), int32(1), handled.Load())
+		delivery, err := transport.Receive(context.Background())
+		suite.Require().NoError(err)
+		assert.JSONEq(suite.T(), `{"id": "1"}`, string(delivery.Message), "the failed message is left for the next consumer")
+	})
+	suite.Run("should stop when a handler fails after acknowledging the message", func() {
+		transport := NewChannelTransport(0)
+		send(transport, testEvent{ID: "1"})
+
+		err := consumeFailing(transport, func(ctx *ConsumerCtx) error {
+			_ = ctx.Ack()
+			time.Sleep(20 * time.Millisecond)
+			return errors.New("database down")
+		})
+
+		assert.EqualError(suite.T(), err, "database down")
+	})
+}
+
+func benchmarkConsume(b *testing.B, opts ...ConsumerOption) {
+	transport := NewChannelTransport(0)
+	consumer, _ := NewConsumer(append(opts, WithConsumerTransport(transport))...)
+	for i := range b.N {
+		data, _ := json.Marshal(testEvent{ID: strconv.Itoa(i)})
+		_ = transport.Send(data)
+	}
+	_ = transport.Close()
+
+	b.ResetTimer()
+	_ = consumer.Consume(context.Background(), ParseMessage[testEvent], func(ctx *ConsumerCtx) error {
+		time.Sleep(100 * time.Microsecond) //REVIEW: simulates the io of a handler, e.g. a repository call
+		return nil
+	})
+}
+
+func BenchmarkConsume(b *testing.B) {
+	b.Run("sequential", func(b *testing.B) { benchmarkConsume(b) })
+	b.Run("concurrency 8", func(b *testing.B) { benchmarkConsume(b, WithConcurrency(8)) })
+	b.Run("concurrency 8 ordered", func(b *testing.B) {
+		benchmarkConsume(b, WithConcurrency(8), WithOrderingKey(func(event testEvent) string { return event.ID }))
+	})
+}
+
+func (suite *EventsTestSuite) TestContext() {
+
+	suite.Run("should stop consuming when the context is done without closing the transport", func() {
+		transport := NewChannelTransport(0)
+		consumer, _ := NewConsumer(WithConsumerTransport(transport))
+		ctx, cancel := context.WithCancel(context.Background())
+		started, stopped := make(chan struct{}), make(chan error, 1)
+		go func() {
+			stopped <- consumer.Consume(ctx, func(cc *ConsumerCtx) error {
+				close(started)
+				<-cc.Context().Done() //REVIEW: handlers observe the shutdown through the context
+				return cc.Context().Err()
+			})
+		}()
+		_ = transport.Send([]byte(`{}`))
+		<-started
+
+		cancel()
+		select {
+		case err := <-stopped:
+			assert.NoError(suite.T(), err)
+		case <-time.After(time.Second):
+			suite.Fail("consumer did not stop")
+		}
+		assert.NoError(suite.T(), transport.Send([]byte(`{}`)), "the transport stays open")
+		delivery, err := transport.Receive(context.Background())
+		suite.Require().NoError(err)
+		assert.Equal(suite.T(), 2, delivery.Attempt, "the message interrupted by the shutdown is redelivered")
+	})
+	suite.Run("should stop receiving when the context is done", func() {
+		file, _ := OpenFileTransport(suite.T().TempDir())
+		defer file.Close()
+		for _, transport := range []Transport{NewChannelTransport(0), file} {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			_, err := transport.Receive(ctx)
+			cancel()
+			assert.ErrorIs(suite.T(), err, context.DeadlineExceeded)
+		}
+	})
+	suite.Run("should restore the deadline, the trace context and the correlation id of the message", func() {
+		transport := NewChannelTransport(1)
+		producer, _ := NewProducer[testEvent](WithProducerTransport(transport))
+		deadline := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+		ctx, cancel := context.WithDeadline(WithTraceContext(WithCorrelationID(context.Background(), "request-1"), TraceContext{Parent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", State: "vendor=value"}), deadline)
+		defer cancel()
+		suite.Require().NoError(producer.SendContext(ctx, testEvent{ID: "1"}))
+		_ = transport.Close()
+
+		var received context.Context
+		consumer, _ := NewConsumer(WithConsumerTransport(transport))
+		err := consumer.Consume(context.Background(), func(cc *ConsumerCtx) error {
+			received = cc.Context()
+			return nil
+		})
+
+		assert.NoError(suite.T(), err)
+		receivedDeadline, ok := received.Deadline()
+		assert.True(suite.T(), ok)
+		assert.True(suite.T(), deadline.Equal(receivedDeadline))
+		trace, ok := TraceContextFrom(received)
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), TraceContext{Parent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", State: "vendor=value"}, trace)
+		id, ok := CorrelationIDFrom(received)
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), "request-1", id)
+	})
+	suite.Run("should let handlers replace the context of the next ones", func() {
+		type key struct{}
+		cc := &ConsumerCtx{values: make(map[string]any), handlers: []Handler{
+			func(cc *ConsumerCtx) error {
+				cc.WithContext(context.WithValue(cc.Context(), key{}, "value"))
+				return cc.Next()
+			},
+			func(cc *ConsumerCtx) error {
+				assert.Equal(suite.T(), "value", cc.Context().Value(key{}))
+				return nil
+			},
+		}}
+		assert.NoError(suite.T(), cc.Next())
+		assert.NotNil(suite.T(), (&ConsumerCtx{}).Context())
+	})
+}
+
+func (suite *EventsTestSuite) TestKeys() {
+
+	count := NewKey[int]("count")
+
+	suite.Run("should get values set with the key", func() {
+		ctx := &ConsumerCtx{}
+		count.Set(ctx, 3)
+
+		value, err := count.Get(ctx)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), 3, value)
+		assert.Equal(suite.T(), 3, count.MustGet(ctx))
+		assert.Equal(suite.T(), 3, ctx.GetValue("count"), "typed keys share the values of the untyped accessors")
+	})
+	suite.Run("should fail instead of panicking on missing values and other types", func() {
+		ctx := &ConsumerCtx{}
+		_, err := count.Get(ctx)
+		assert.ErrorIs(suite.T(), err, ErrValueNotFound)
+
+		ctx.SetValue("count", "three")
+		value, err := count.Get(ctx)
+		assert.ErrorIs(suite.T(), err, ErrValueType)
+		assert.Zero(suite.T(), value)
+		assert.Zero(suite.T(), count.MustGet(ctx))
+	})
+	suite.Run("should get nil values of interface keys", func() {
+		ctx := &ConsumerCtx{}
+		SetErrorObserver(nil)(ctx)
+
+		observer, err := errorObserverKey.Get(ctx)
+		assert.NoError(suite.T(), err)
+		assert.Nil(suite.T(), observer)
+	})
+	suite.Run("should reject nil values of keys whose type cannot be nil", func() {
+		ctx := &ConsumerCtx{}
+		ctx.SetValue("count", nil)
+
+		_, err := count.Get(ctx)
+		assert.ErrorIs(suite.T(), err, ErrValueType)
+
+		ctx.SetValue("headers", nil)
+		headers, err := NewKey[map[string]string]("headers").Get(ctx)
+		assert.NoError(suite.T(), err)
+		assert.Nil(suite.T(), headers)
+	})
+	suite.Run("should expose the message parsed by ParseMessage", func() {
+		ctx := &ConsumerCtx{message: []byte(`{"id": "1"}`)}
+		suite.Require().NoError(ParseMessage[testEvent](ctx))
+
+		message, err := Message[testEvent](ctx)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), testEvent{ID: "1"}, message)
+		_, err = Message[map[string]any](ctx)
+		assert.ErrorIs(suite.T(), err, ErrValueType)
+	})
+}
+
+func (suite *EventsTestSuite) TestEnvelope() {
+
+	suite.Run("should marshal envelopes as cloudevents", func() {
+		envelope := Envelope{
+			ID:          "1",
+			Type:        "record.created",
+			Source:      "/test",
+			Time:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			ContentType: ContentTypeJSON,
+			DataSchema:  "urn:record:v2",
+			Headers:     map[string]string{HeaderCorrelationID: "abc"},
+			Payload:     []byte(`{"id":"1"}`),
+		}
+		content, err := json.Marshal(envelope)
+		assert.NoError(suite.T(), err)
+		assert.JSONEq(suite.T(), `{
+			"specversion": "1.0",
+			"id": "1",
+			"type": "record.created",
+			"source": "/test",
+			"time": "2024-01-02T03:04:05Z",
+			"datacontenttype": "application/json",
+			"dataschema": "urn:record:v2",
+			"correlationid": "abc",
+			"data": {"id":"1"}
+		}`, string(content))
+
+		var decoded Envelope
+		assert.NoError(suite.T(), json.Unmarshal(content, &decoded))
+		assert.Equal(suite.T(), envelope, decoded)
+	})
+	suite.Run("should encode non json payloads in base64", func() {
+		envelope := NewEnvelope("binary", "/test", []byte{0xff, 0x00})
+		envelope.ContentType = "application/octet-stream"
+		content, _ := json.Marshal(envelope)
+		assert.Contains(suite.T(), string(content), `"data_base64":"/wA="`)
+
+		decoded, ok := ParseEnvelope(content)
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), []byte{0xff, 0x00}, decoded.Payload)
+	})
+	suite.Run("should reject invalid headers", func() {
+		_, err := json.Marshal(NewEnvelope("type", "/test", nil).WithHeaders(map[string]string{"correlation_id": "abc"}))
+		assert.ErrorIs(suite.T(), err, ErrInvalidHeader)
+		assert.ErrorIs(suite.T(), ValidateHeader("type"), ErrInvalidHeader)
+	})
+	suite.Run("should take other messages as bare payloads", func() {
+		envelope, ok := ParseEnvelope([]byte(`{"id": "1"}`))
+		assert.False(suite.T(), ok)
+		assert.Equal(suite.T(), []byte(`{"id": "1"}`), envelope.Payload)
+	})
+	suite.Run("should expose the envelope to the chain before parsing the message", func() {
+		transport := NewChannelTransport(0)
+		producer, _ := NewProducer[testEvent](WithProducerTransport(transport), WithEventType("test.created"), WithSource("/events-test"))
+		consumer, _ := NewConsumer(WithConsumerTransport(transport))
+		assert.NoError(suite.T(), producer.SendWithHeaders(testEvent{ID: "1"}, map[string]string{HeaderCorrelationID: "abc"}))
+		_ = transport.Close()
+
+		var envelope Envelope
+		var event testEvent
+		err := consumer.Consume(context.Background(), func(ctx *ConsumerCtx) error {
+			envelope = ctx.Envelope()
+			assert.Equal(suite.T(), "abc", ctx.Header(HeaderCorrelationID))
+			return ctx.Next()
+		}, ParseMessage[testEvent], func(ctx *ConsumerCtx) error {
+			event = ctx.GetValue("message").(testEvent)
+			return nil
+		})
+
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), "test.created", envelope.Type)
+		assert.Equal(suite.T(), "/events-test", envelope.Source)
+		assert.NotEmpty(suite.T(), envelope.ID)
+		assert.WithinDuration(suite.T(), time.Now(), envelope.Time, time.Minute)
+		assert.Equal(suite.T(), testEvent{ID: "1"}, event)
+	})
+}
+
+func (suite *EventsTestSuite) TestRouter() {
+
+	type renamedEvent struct {
+		Name string `json:"name"`
+	}
+
+	consume := func(router *Router, envelopes ...Envelope) (*ChannelTransport, *MemoryDeadLetterStore, error) {
+		transport := NewChannelTransport(0)
+		store := NewMemoryDeadLetterStore()
+		for _, envelope := range envelopes {
+			data, _ := json.Marshal(envelope)
+			_ = transport.Send(data)
+		}
+		_ = transport.Close()
+		consumer, _ := NewConsumer(WithConsumerTransport(transport), WithDeadLetters(store))
+		return transport, store, consumer.Consume(context.Background(), SetLogger(slog.New(slog.NewJSONHandler(io.Discard, nil))), router.Dispatch)
+	}
+	created := NewEnvelope("test.created", "/test", []byte(`{"id": "1"}`))
+	renamed := NewEnvelope("test.renamed", "/test", []byte(`{"name": "new"}`))
+	unknown := NewEnvelope("test.deleted", "/test", []byte(`{"id": "1"}`))
+
+	suite.Run("should dispatch each type to its chain with its own message type", func() {
+		var received []any
+		router := NewRouter()
+		Route[testEvent](router, "test.created", func(ctx *ConsumerCtx) error {
+			received = append(received, ctx.GetValue("message"))
+			return nil
+		})
+		Route[renamedEvent](router, "test.renamed", func(ctx *ConsumerCtx) error {
+			received = append(received, ctx.GetValue("message"))
+			return nil
+		})
+
+		_, store, err := consume(router, created, renamed)
+		letters, _ := store.List()
+
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), []any{testEvent{ID: "1"}, renamedEvent{Name: "new"}}, received)
+		assert.Empty(suite.T(), letters)
+	})
+	suite.Run("should report errors and dead letters for the route handler", func() {
+		var occurrences []errs.Occurrence
+		router := NewRouter()
+		Route[testEvent](router, "test.created", func(ctx *ConsumerCtx) error {
+			return errs.NewError(errors.New("invalid record"), errs.WithClass(errs.ClassPermanent))
+		})
+		Route[renamedEvent](router, "test.renamed", func(ctx *ConsumerCtx) error {
+			return errors.New("database down")
+		})
+		transport := NewChannelTransport(0)
+		for _, envelope := range []Envelope{created, renamed} {
+			data, _ := json.Marshal(envelope)
+			_ = transport.Send(data)
+		}
+		_ = transport.Close()
+		store := NewMemoryDeadLetterStore()
+		consumer, _ := NewConsumer(WithConsumerTransport(transport), WithDeadLetters(store))
+
+		err := consumer.Consume(context.Background(),
+			SetLogger(slog.New(slog.NewJSONHandler(io.Discard, nil))),
+			SetErrorObserver(errs.ObserverFunc(func(occurrence errs.Occurrence) { occurrences = append(occurrences, occurrence) })),
+			ErrorRecover,
+			router.Dispatch,
+		)
+		letters, _ := store.List()
+
+		assert.NoError(suite.T(), err)
+		suite.Require().Len(occurrences, 2)
+		suite.Require().Len(letters, 2)
+		for i := range letters {
+			assert.Contains(suite.T(), occurrences[i].Route, "TestRouter")
+			assert.Contains(suite.T(), letters[i].Handler, "TestRouter")
+			assert.NotContains(suite.T(), letters[i].Handler, "Dispatch")
+		}
+	})
+	suite.Run("should skip unknown types", func() {
+		_, store, err := consume(NewRouter(WithUnknownTypePolicy(UnknownTypeSkip)), unknown)
+		letters, _ := store.List()
+		assert.NoError(suite.T(), err)
+		assert.Empty(suite.T(), letters)
+	})
+	suite.Run("should dead-letter unknown types", func() {
+		_, store, err := consume(NewRouter(), unknown)
+		letters, _ := store.List()
+		assert.NoError(suite.T(), err)
+		suite.Require().Len(letters, 1)
+		assert.Contains(suite.T(), string(letters[0].Error), "unknown event type")
+	})
+	suite.Run("should drop unknown types and say so when there is no dead letter store", func() {
+		var buffer bytes.Buffer
+		transport := NewChannelTransport(0)
+		data, _ := json.Marshal(unknown)
+		_ = transport.Send(data)
+		_ = transport.Close()
+		consumer, _ := NewConsumer(WithConsumerTransport(transport))
+
+		err := consumer.Consume(context.Background(), SetLogger(slog.New(slog.NewJSONHandler(&buffer, nil))), NewRouter().Dispatch)
+
+		assert.NoError(suite.T(), err)
+		assert.Contains(suite.T(), buffer.String(), "dropping event without dead letter store")
+		assert.NotContains(suite.T(), buffer.String(), "dead-lettering event")
+	})
+	suite.Run("should fail on unknown types leaving the message in the queue", func() {
+		transport, store, err := consume(NewRouter(WithUnknownTypePolicy(UnknownTypeFail)), unknown)
+		letters, _ := store.List()
+		assert.ErrorIs(suite.T(), err, ErrUnknownEventType)
+		assert.Empty(suite.T(), letters)
+
+		delivery, err := transport.Receive(context.Background())
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), 2, delivery.Attempt)
+	})
+}
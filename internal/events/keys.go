@@ -0,0 +1,74 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+
+	errs "github.com/vfcoelho/go-project-pocs/internal/errors"
+)
+
+var (
+	ErrValueNotFound = errors.New("context value not found")
+	ErrValueType     = errors.New("context value of another type")
+)
+
+type Key[T any] struct { //REVIEW: typed name of a context value, middlewares and handlers sharing the key agree on its type at compile time
+	name string
+}
+
+func NewKey[T any](name string) Key[T] {
+	return Key[T]{name: name}
+}
+
+const messageKeyName = "message" // typed by the ParseMessage and Message type parameters
+
+var (
+	errorRegistryKey = NewKey[*errs.Registry]("errorRegistry")
+	loggerKey        = NewKey[*slog.Logger]("logger")
+	errorObserverKey = NewKey[errs.Observer]("errorObserver")
+	retryAttemptKey  = NewKey[int]("retryAttempt")    // attempt of the Retry middleware, which then owns the retries of the message
+	routeHandlerKey  = NewKey[string]("routeHandler") // handler of the route the Router dispatched the message to
+)
+
+func (k Key[T]) Name() string {
+	return k.name
+}
+
+func (k Key[T]) Set(ctx *ConsumerCtx, value T) {
+	ctx.SetValue(k.name, value)
+}
+
+func (k Key[T]) Get(ctx *ConsumerCtx) (T, error) { //REVIEW: fails instead of panicking when the value is missing or was set with another type
+	var zero T
+	value, ok := ctx.values[k.name]
+	if !ok {
+		return zero, fmt.Errorf("%w: %s", ErrValueNotFound, k.name)
+	}
+	if value == nil && nilable(reflect.TypeFor[T]()) { //REVIEW: nil is only a valid value of the key when T can hold it
+		return zero, nil
+	}
+	typed, ok := value.(T)
+	if !ok {
+		return zero, fmt.Errorf("%w: %s is %T, not %s", ErrValueType, k.name, value, reflect.TypeFor[T]())
+	}
+	return typed, nil
+}
+
+func nilable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return true
+	}
+	return false
+}
+
+func (k Key[T]) MustGet(ctx *ConsumerCtx) T { //REVIEW: zero value when the value is missing or of another type, for optional values
+	value, _ := k.Get(ctx)
+	return value
+}
+
+func Message[T any](ctx *ConsumerCtx) (T, error) { //REVIEW: the message decoded by ParseMessage, the type must match the one given to the parser
+	return NewKey[T](messageKeyName).Get(ctx)
+}
@@ -3,24 +3,52 @@ package events
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
+	"log/slog"
 
 	errs "github.com/vfcoelho/go-project-pocs/internal/errors"
 )
 
-func ParseMessage[T any](ctx *ConsumerCtx) error { //REVIEW: standardized parser to prevent code duplication in workers
+func ParseMessage[T any](ctx *ConsumerCtx) error { //REVIEW: standardized parser to prevent code duplication in workers, the message is read back with Message[T]
 	var message T
 	err := json.Unmarshal(ctx.GetMessage(), &message)
 	if err != nil {
 		return err
 	}
-	ctx.SetValue("message", message)
+	NewKey[T](messageKeyName).Set(ctx, message)
 	return ctx.Next()
 }
 
-func SetCodeErrorMappings(mappings map[errs.ErrorCode]bool) func(*ConsumerCtx) error { //REVIEW: fiber middleware to set error mappings and later be used by the error response middleware
+func SetErrorRegistry(registry *errs.Registry) func(*ConsumerCtx) error { //REVIEW: worker middleware to set the error registry and later be used by the error recover middleware
 	return func(ctx *ConsumerCtx) (err error) {
-		ctx.SetValue("codeErrorMappings", mappings)
+		errorRegistryKey.Set(ctx, registry)
+		return ctx.Next()
+	}
+}
+
+func SetLogger(logger *slog.Logger) func(*ConsumerCtx) error { //REVIEW: worker middleware to inject the logger used by the error recover middleware
+	return func(ctx *ConsumerCtx) (err error) {
+		loggerKey.Set(ctx, logger)
+		return ctx.Next()
+	}
+}
+
+func getLogger(ctx *ConsumerCtx) *slog.Logger {
+	if logger := loggerKey.MustGet(ctx); logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
+
+func getErrorRegistry(ctx *ConsumerCtx) *errs.Registry {
+	if registry := errorRegistryKey.MustGet(ctx); registry != nil {
+		return registry
+	}
+	return errs.DefaultRegistry
+}
+
+func SetErrorObserver(observer errs.Observer) func(*ConsumerCtx) error { //REVIEW: worker middleware to inject the observer notified of every error handled by the error recover middleware
+	return func(ctx *ConsumerCtx) (err error) {
+		errorObserverKey.Set(ctx, observer)
 		return ctx.Next()
 	}
 }
@@ -29,15 +57,20 @@ func ErrorRecover(ctx *ConsumerCtx) error { //REVIEW: error handling middleware
 	err := ctx.Next()
 
 	if err != nil {
+		errs.Observe(errorObserverKey.MustGet(ctx), err, errs.TransportEvents, ctx.HandlerName())
 		var customErr errs.Error
 		switch {
 		case errors.As(err, &customErr):
-			stringErr, err := json.Marshal(customErr)
-			if err != nil {
-				return fmt.Errorf("error marshalling custom error: %w", err)
+			registry := getErrorRegistry(ctx)
+			definition, ok := registry.Definition(err)
+			if !ok {
+				definition = errs.CodeDefinition{Code: customErr.Code, Severity: errs.SeverityError}
+			}
+			if registry.IsRetryable(err) { //REVIEW: retryable errors are handed back to the consumer instead of being dropped
+				return err
 			}
-			fmt.Println(string(stringErr))
-			return nil
+			getLogger(ctx).Log(ctx.Context(), definition.Severity.Level(), err.Error(), slog.Any("error", customErr))
+			return ctx.DeadLetter(err) //REVIEW: errors that retrying will not fix are dead-lettered instead of dropped
 		default:
 			return err
 		}
@@ -0,0 +1,121 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	errs "github.com/vfcoelho/go-project-pocs/internal/errors"
+)
+
+type Backoff func(attempt int) time.Duration // delay before the attempt following the given one
+
+func ConstantBackoff(delay time.Duration) Backoff {
+	return func(int) time.Duration {
+		return delay
+	}
+}
+
+func ExponentialBackoff(initial time.Duration, multiplier float64, max time.Duration) Backoff { //REVIEW: initial, initial*multiplier, initial*multiplier^2... capped at max
+	return func(attempt int) time.Duration {
+		delay := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+		if delay > float64(max) {
+			return max
+		}
+		return time.Duration(delay)
+	}
+}
+
+type RetryPolicy struct {
+	MaxAttempts int           // attempts including the first one, 1 disables retries
+	Backoff     Backoff       // delays between attempts, a retry after defined by the error wins when longer
+	Jitter      float64       // fraction of each delay that is randomized, from 0 to 1, so failing consumers do not retry in lockstep
+	MaxElapsed  time.Duration // no attempt starts after this time since the first one, 0 disables the limit
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	Backoff:     ExponentialBackoff(100*time.Millisecond, 2, 5*time.Second),
+	Jitter:      0.2,
+	MaxElapsed:  30 * time.Second,
+}
+
+func (rp RetryPolicy) delay(attempt int, err error, registry *errs.Registry) time.Duration {
+	var delay time.Duration
+	if rp.Backoff != nil {
+		delay = rp.Backoff(attempt)
+	}
+	delay -= time.Duration(rand.Float64() * rp.Jitter * float64(delay))
+	if retryAfter, ok := registry.RetryAfter(err); ok && retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay
+}
+
+type RetryOption func(*retryConfig) //REVIEW: provides with-builder methods to configure the retry middleware
+
+type retryConfig struct {
+	policy RetryPolicy
+	codes  map[errs.ErrorCode]RetryPolicy
+	sleep  func(ctx context.Context, delay time.Duration) error
+}
+
+func WithRetryPolicy(policy RetryPolicy) RetryOption { //REVIEW: policy of retryable errors without a code policy
+	return func(rc *retryConfig) {
+		rc.policy = policy
+	}
+}
+func WithCodeRetryPolicy(code errs.ErrorCode, policy RetryPolicy) RetryOption { //REVIEW: policy of the code and its children, errors with a code policy are retried even if they are not retryable
+	return func(rc *retryConfig) {
+		rc.codes[code] = policy
+	}
+}
+
+func (rc retryConfig) policyOf(err error, registry *errs.Registry) (RetryPolicy, bool) {
+	if definition, ok := registry.Definition(err); ok {
+		for _, code := range definition.Code.Ancestors() {
+			if policy, ok := rc.codes[code]; ok {
+				return policy, true
+			}
+		}
+	}
+	return rc.policy, registry.IsRetryable(err)
+}
+
+func Retry(opts ...RetryOption) Handler { //REVIEW: worker middleware re-running the rest of the chain, retries exhausted are dead-lettered when the consumer has a dead letter store
+	config := retryConfig{policy: DefaultRetryPolicy, codes: make(map[errs.ErrorCode]RetryPolicy), sleep: sleepContext}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return func(ctx *ConsumerCtx) error {
+		pivot, start := ctx.pivot, time.Now()
+		for attempt := 1; ; attempt++ {
+			ctx.pivot, ctx.attempt = pivot, attempt
+			retryAttemptKey.Set(ctx, attempt) //REVIEW: shared with the consumer, which does not retry on its own when the chain retries so attempts do not multiply
+			err := ctx.Next()
+			if err == nil || ctx.delivery != nil && ctx.delivery.Settled() {
+				return err
+			}
+			registry := getErrorRegistry(ctx)
+			policy, retryable := config.policyOf(err, registry)
+			if !retryable {
+				return err
+			}
+			delay := policy.delay(attempt, err, registry)
+			exhausted := attempt >= policy.MaxAttempts || policy.MaxElapsed > 0 && time.Since(start)+delay > policy.MaxElapsed
+			if exhausted {
+				getLogger(ctx).Log(ctx.Context(), slog.LevelError, "retries exhausted", slog.Int("attempt", attempt), slog.Any("error", err))
+				if ctx.deadLetters == nil {
+					return err
+				}
+				return ctx.DeadLetter(err)
+			}
+			getLogger(ctx).Log(ctx.Context(), slog.LevelWarn, "retrying event", slog.Int("attempt", attempt), slog.Duration("delay", delay), slog.Any("error", err))
+			if config.sleep(ctx.Context(), delay) != nil { //REVIEW: the consumer is stopping or the deadline of the message elapsed, the last error is handed back
+				return err
+			}
+		}
+	}
+}
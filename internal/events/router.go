@@ -0,0 +1,79 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+var ErrUnknownEventType = errors.New("unknown event type")
+
+type UnknownTypePolicy string
+
+const (
+	UnknownTypeSkip       UnknownTypePolicy = "skip"        // the message is acknowledged and dropped
+	UnknownTypeDeadLetter UnknownTypePolicy = "dead_letter" // the message is dead-lettered, or dropped when there is no dead letter store
+	UnknownTypeFail       UnknownTypePolicy = "fail"        // the message is left in the queue and the consumer stops, e.g. until a version handling it is deployed
+)
+
+type Router struct { //REVIEW: dispatches messages to handler chains by their envelope type, so one consumer can handle several events
+	mutex  sync.RWMutex
+	routes map[string][]Handler
+	policy UnknownTypePolicy
+}
+
+type RouterOption func(*Router) //REVIEW: provides with-builder methods to configure routers
+
+func WithUnknownTypePolicy(policy UnknownTypePolicy) RouterOption {
+	return func(r *Router) {
+		r.policy = policy
+	}
+}
+
+func NewRouter(opts ...RouterOption) *Router {
+	router := &Router{routes: make(map[string][]Handler), policy: UnknownTypeDeadLetter}
+	for _, opt := range opts {
+		opt(router)
+	}
+	return router
+}
+
+func (r *Router) Handle(eventType string, handlers ...Handler) *Router { //REVIEW: registers the chain run for the type, replacing any previous one
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.routes[eventType] = handlers
+	return r
+}
+
+func Route[T any](router *Router, eventType string, handlers ...Handler) *Router { //REVIEW: registers a chain whose messages are parsed as T before running the handlers
+	return router.Handle(eventType, append([]Handler{ParseMessage[T]}, handlers...)...)
+}
+
+func (r *Router) Dispatch(ctx *ConsumerCtx) error { //REVIEW: worker middleware, the chain of the type runs as the rest of the chain
+	eventType := ctx.Envelope().Type
+	r.mutex.RLock()
+	handlers, ok := r.routes[eventType]
+	r.mutex.RUnlock()
+	if ok {
+		routeHandlerKey.Set(ctx, handlerName(handlers)) //REVIEW: errors and dead letters are reported for the route handler, not for the router
+		return ctx.branch(handlers).Next()
+	}
+
+	err := fmt.Errorf("%w: %q", ErrUnknownEventType, eventType)
+	switch r.policy {
+	case UnknownTypeSkip:
+		getLogger(ctx).Log(ctx.Context(), slog.LevelInfo, "skipping event", slog.String("type", eventType), slog.String("id", ctx.Envelope().ID))
+		return ctx.Ack()
+	case UnknownTypeFail:
+		_ = ctx.Nack()
+		return err
+	default:
+		if ctx.deadLetters == nil { //REVIEW: the consumer has no dead letter store, the message is dropped and the log is the only trace left of it
+			getLogger(ctx).Log(ctx.Context(), slog.LevelWarn, "dropping event without dead letter store", slog.String("type", eventType), slog.String("id", ctx.Envelope().ID))
+			return ctx.Ack()
+		}
+		getLogger(ctx).Log(ctx.Context(), slog.LevelWarn, "dead-lettering event", slog.String("type", eventType), slog.String("id", ctx.Envelope().ID))
+		return ctx.DeadLetter(err)
+	}
+}
@@ -0,0 +1,238 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/billziss-gh/netchan/netchan"
+)
+
+const (
+	DefaultNetchanURI = "tcp://127.0.0.1/events"
+	DefaultNetchanID  = "events"
+)
+
+var (
+	ErrTransportClosed = errors.New("transport closed")
+	ErrNotConfirmed    = errors.New("message not confirmed")
+)
+
+type Transport interface { //REVIEW: moves raw messages between producers and consumers, so the same handler chains run on any broker
+	Send(message []byte) error                      // returns once the receiving side accepted the message
+	Receive(ctx context.Context) (*Delivery, error) // blocks until a message arrives, returns ErrTransportClosed once the transport is closed and drained or the context error once it is done
+	Close() error
+}
+
+type TransportOption func(*transportConfig) //REVIEW: provides with-builder methods to configure the bundled transports
+
+type transportConfig struct {
+	visibilityTimeout time.Duration
+	confirmTimeout    time.Duration
+	segmentSize       int64
+	retention         time.Duration
+	pollInterval      time.Duration
+	inboxDir          string
+}
+
+func WithVisibilityTimeout(timeout time.Duration) TransportOption { //REVIEW: time a received message has to be acknowledged before it is redelivered
+	return func(tc *transportConfig) {
+		tc.visibilityTimeout = timeout
+	}
+}
+func WithConfirmTimeout(timeout time.Duration) TransportOption { //REVIEW: time the receiving side has to confirm a sent message
+	return func(tc *transportConfig) {
+		tc.confirmTimeout = timeout
+	}
+}
+func WithSegmentSize(size int64) TransportOption { //REVIEW: size after which the file transport starts a new log segment
+	return func(tc *transportConfig) {
+		tc.segmentSize = size
+	}
+}
+func WithRetention(retention time.Duration) TransportOption { //REVIEW: age after which sealed log segments are removed even if they were not consumed, 0 keeps them until consumed
+	return func(tc *transportConfig) {
+		tc.retention = retention
+	}
+}
+func WithPollInterval(interval time.Duration) TransportOption { //REVIEW: delay between reads of the log when the file transport has nothing to deliver, messages sent by other processes are only seen when polling
+	return func(tc *transportConfig) {
+		tc.pollInterval = interval
+	}
+}
+
+func WithInboxDir(dir string) TransportOption { //REVIEW: the exposed netchan appends the messages it receives to a file transport in the directory and only confirms them once synced, so they survive a restart of the receiving process
+	return func(tc *transportConfig) {
+		tc.inboxDir = dir
+	}
+}
+
+func newTransportConfig(opts []TransportOption) transportConfig {
+	config := transportConfig{visibilityTimeout: 30 * time.Second, confirmTimeout: 10 * time.Second, segmentSize: 16 << 20, pollInterval: 100 * time.Millisecond}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+type ChannelTransport struct { //REVIEW: in-process transport, producers and consumers sharing it must live in the same process, e.g. tests
+	queue *memoryQueue
+}
+
+func NewChannelTransport(size int, opts ...TransportOption) *ChannelTransport {
+	config := newTransportConfig(opts)
+	return &ChannelTransport{queue: newMemoryQueue(size, config.visibilityTimeout)}
+}
+
+func (ct *ChannelTransport) Send(message []byte) error {
+	return ct.queue.push(message)
+}
+
+func (ct *ChannelTransport) Receive(ctx context.Context) (*Delivery, error) {
+	return ct.queue.pop(ctx)
+}
+
+func (ct *ChannelTransport) Close() error {
+	ct.queue.close()
+	return nil
+}
+
+type netchanMessage struct { //REVIEW: the confirm channel travels with the message, netchan routes the confirmation back to the sender
+	Data    []byte
+	Confirm chan bool
+}
+
+func init() {
+	netchan.DefaultMarshaler.RegisterType(netchanMessage{})
+}
+
+type NetchanTransport struct { //REVIEW: netchan transport, a bound transport only sends and an exposed one only receives. It is only durable with WithInboxDir, otherwise messages are kept in memory by the receiving process and are lost when it stops
+	id        string
+	channel   chan netchanMessage
+	exposed   bool
+	config    transportConfig
+	inbox     Transport // where the exposed end keeps the confirmed messages until they are received
+	mutex     sync.RWMutex
+	closed    bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func BindNetchan(uri string, opts ...TransportOption) (*NetchanTransport, error) { //REVIEW: sending end, connected to the channel exposed under the uri path
+	channel := make(chan netchanMessage)
+	errch := make(chan error, 1)
+	if err := netchan.Bind(uri, channel, errch); err != nil {
+		return nil, fmt.Errorf("error binding netchan %s: %w", uri, err)
+	}
+	nt := &NetchanTransport{id: uri, channel: channel, config: newTransportConfig(opts), done: make(chan struct{})}
+	go func() {
+		for {
+			select {
+			case err := <-errch:
+				slog.Error("error sending event", slog.Any("error", err))
+			case <-nt.done:
+				return
+			}
+		}
+	}()
+	return nt, nil
+}
+
+func ExposeNetchan(id string, opts ...TransportOption) (*NetchanTransport, error) { //REVIEW: receiving end, listening on the netchan default address
+	config := newTransportConfig(opts)
+	var inbox Transport = NewChannelTransport(0, opts...)
+	if config.inboxDir != "" {
+		file, err := OpenFileTransport(config.inboxDir, opts...)
+		if err != nil {
+			return nil, err
+		}
+		inbox = file
+	}
+	channel := make(chan netchanMessage)
+	if err := netchan.Expose(id, channel); err != nil {
+		_ = inbox.Close()
+		return nil, fmt.Errorf("error exposing netchan %s: %w", id, err)
+	}
+	nt := &NetchanTransport{id: id, channel: channel, exposed: true, config: config, inbox: inbox, done: make(chan struct{})}
+	go func() {
+		for {
+			select {
+			case message := <-channel:
+				err := nt.inbox.Send(message.Data)
+				if err != nil {
+					slog.Error("error receiving event", slog.String("netchan", nt.id), slog.Any("error", err))
+				}
+				select {
+				case message.Confirm <- err == nil: //REVIEW: the message is only confirmed once the inbox accepted it, once synced to disk with WithInboxDir
+				case <-nt.done:
+					return
+				}
+			case <-nt.done:
+				return
+			}
+		}
+	}()
+	return nt, nil
+}
+
+func (nt *NetchanTransport) Send(message []byte) error {
+	if nt.exposed {
+		return fmt.Errorf("netchan %s is exposed to receive: %w", nt.id, errors.ErrUnsupported)
+	}
+	confirm := make(chan bool, 1)
+	timeout := time.NewTimer(nt.config.confirmTimeout) //REVIEW: a single deadline covers handing the message over and its confirmation
+	defer timeout.Stop()
+	nt.mutex.RLock()
+	if nt.closed {
+		nt.mutex.RUnlock()
+		return ErrTransportClosed
+	}
+	select { //REVIEW: the send must not block while holding the lock, Close closes done first so blocked senders release it
+	case nt.channel <- netchanMessage{Data: message, Confirm: confirm}:
+		nt.mutex.RUnlock()
+	case <-nt.done:
+		nt.mutex.RUnlock()
+		return ErrTransportClosed
+	case <-timeout.C:
+		nt.mutex.RUnlock()
+		return fmt.Errorf("netchan %s did not take the message in %s: %w", nt.id, nt.config.confirmTimeout, ErrNotConfirmed)
+	}
+
+	select {
+	case accepted := <-confirm:
+		if !accepted {
+			return fmt.Errorf("netchan %s rejected the message: %w", nt.id, ErrNotConfirmed)
+		}
+		return nil
+	case <-nt.done:
+		return ErrTransportClosed
+	case <-timeout.C:
+		return fmt.Errorf("netchan %s did not confirm the message in %s: %w", nt.id, nt.config.confirmTimeout, ErrNotConfirmed)
+	}
+}
+
+func (nt *NetchanTransport) Receive(ctx context.Context) (*Delivery, error) {
+	if !nt.exposed {
+		return nil, fmt.Errorf("netchan %s is bound to send: %w", nt.id, errors.ErrUnsupported)
+	}
+	return nt.inbox.Receive(ctx)
+}
+
+func (nt *NetchanTransport) Close() (err error) {
+	nt.closeOnce.Do(func() {
+		close(nt.done)
+		nt.mutex.Lock()
+		defer nt.mutex.Unlock()
+		nt.closed = true
+		if nt.exposed {
+			netchan.Unexpose(nt.id, nt.channel) //REVIEW: the channel is left open, netchan may still be delivering to it
+			err = nt.inbox.Close()
+			return
+		}
+		close(nt.channel)
+	})
+	return
+}
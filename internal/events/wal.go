@@ -0,0 +1,533 @@
+package events
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	walSegmentExt    = ".wal"
+	walOffsetFile    = "offset"
+	walLockFile      = "lock"
+	walReceiverLock  = "receiver.lock"
+	walHeaderSize    = 8 // big endian length and crc32c checksum of the message
+	walMaxRecordSize = 64 << 20
+)
+
+var (
+	ErrCorruptRecord  = errors.New("corrupt log record")
+	ErrReceiverLocked = errors.New("log already has a receiver")
+)
+
+var walTable = crc32.MakeTable(crc32.Castagnoli)
+
+type walEntry struct {
+	offset   int64
+	message  []byte
+	attempts int
+	timer    *time.Timer
+}
+
+type FileTransport struct { //REVIEW: write-ahead log transport, messages are appended to segment files and survive restarts of the sending and the receiving processes
+	dir        string
+	config     transportConfig
+	mutex      sync.Mutex
+	lock       *os.File
+	receiver   *os.File // held while receiving so a single process receives from the log
+	writer     *os.File
+	writerBase int64
+	writerSize int64
+	reader     *os.File
+	readerBase int64
+	position   int64 // offset of the next record to read
+	committed  int64 // offset every record before which was acknowledged
+	compacted  int64 // segment being read when the consumed segments were last removed
+	consuming  bool
+	ready      []*walEntry
+	inflight   map[uint64]*walEntry
+	lease      uint64
+	closed     bool
+	wake       chan struct{}
+	done       chan struct{}
+}
+
+func OpenFileTransport(dir string, opts ...TransportOption) (*FileTransport, error) { //REVIEW: processes sharing the directory share the queue, any number of them may send but only one may receive
+	if !fileLocksSupported {
+		return nil, fmt.Errorf("file transport needs advisory file locks: %w", errors.ErrUnsupported)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileTransport{
+		dir:      dir,
+		config:   newTransportConfig(opts),
+		inflight: make(map[uint64]*walEntry),
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+func (ft *FileTransport) Send(message []byte) error { //REVIEW: returns once the message is synced to disk
+	if len(message) > walMaxRecordSize {
+		return fmt.Errorf("message of %d bytes exceeds the log record limit of %d bytes", len(message), walMaxRecordSize)
+	}
+	record := make([]byte, walHeaderSize+len(message))
+	binary.BigEndian.PutUint32(record[:4], uint32(len(message)))
+	binary.BigEndian.PutUint32(record[4:walHeaderSize], crc32.Checksum(message, walTable))
+	copy(record[walHeaderSize:], message)
+
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+	if ft.closed {
+		return ErrTransportClosed
+	}
+	unlock, err := ft.lockWriter()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := ft.openWriter(); err != nil {
+		return err
+	}
+	if ft.writerSize > 0 && ft.writerSize+int64(len(record)) > ft.config.segmentSize {
+		if err := ft.rotate(); err != nil {
+			return err
+		}
+	}
+	if _, err := ft.writer.WriteAt(record, ft.writerSize); err != nil {
+		return fmt.Errorf("error appending to log segment %d: %w", ft.writerBase, err)
+	}
+	if err := ft.writer.Sync(); err != nil {
+		return fmt.Errorf("error syncing log segment %d: %w", ft.writerBase, err)
+	}
+	ft.writerSize += int64(len(record))
+	ft.signal()
+	return nil
+}
+
+func (ft *FileTransport) lockWriter() (func(), error) { //REVIEW: appends of other processes are serialized through a lock file
+	if ft.lock == nil {
+		lock, err := os.OpenFile(filepath.Join(ft.dir, walLockFile), os.O_RDWR|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		ft.lock = lock
+	}
+	if err := lockFile(ft.lock); err != nil {
+		return nil, fmt.Errorf("error locking log %s: %w", ft.dir, err)
+	}
+	return func() { _ = unlockFile(ft.lock) }, nil
+}
+
+func (ft *FileTransport) lockReceiver() error { //REVIEW: the lock is held until the transport is closed, a second receiver fails instead of delivering the same messages
+	if ft.receiver != nil {
+		return nil
+	}
+	receiver, err := os.OpenFile(filepath.Join(ft.dir, walReceiverLock), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := tryLockFile(receiver); err != nil {
+		_ = receiver.Close()
+		return fmt.Errorf("error receiving from log %s: %w", ft.dir, err)
+	}
+	ft.receiver = receiver
+	return nil
+}
+
+func (ft *FileTransport) openWriter() error { //REVIEW: catches up with segments written by other processes since the last append
+	segments, err := walSegments(ft.dir)
+	if err != nil {
+		return err
+	}
+	base := int64(0)
+	if len(segments) > 0 {
+		base = segments[len(segments)-1]
+	}
+	if ft.writer != nil && ft.writerBase == base {
+		return ft.repair(ft.writer, base, ft.writerSize)
+	}
+	if ft.writer != nil {
+		_ = ft.writer.Close()
+		ft.writer = nil
+	}
+	writer, err := os.OpenFile(ft.segmentPath(base), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := ft.repair(writer, base, 0); err != nil {
+		_ = writer.Close()
+		return err
+	}
+	ft.writer, ft.writerBase = writer, base
+	return nil
+}
+
+func (ft *FileTransport) repair(writer *os.File, base int64, from int64) error { //REVIEW: a record torn by a crash or a failed append is never delivered, the tail is dropped before appending after it
+	info, err := writer.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if size < from {
+		from = 0
+	}
+	if size != from {
+		if size, err = walValidSize(writer, from); err != nil {
+			return err
+		}
+	}
+	if info.Size() > size {
+		slog.Warn("truncating torn log record", slog.Int64("segment", base), slog.Int64("size", info.Size()), slog.Int64("valid", size))
+		if err := writer.Truncate(size); err != nil {
+			return err
+		}
+	}
+	ft.writerSize = size
+	return nil
+}
+
+func (ft *FileTransport) rotate() error {
+	if err := ft.writer.Close(); err != nil {
+		return err
+	}
+	base := ft.writerBase + ft.writerSize //REVIEW: segments are named after the offset of their first record, so offsets are unique across segments
+	writer, err := os.OpenFile(ft.segmentPath(base), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		ft.writer = nil
+		return err
+	}
+	ft.writer, ft.writerBase, ft.writerSize = writer, base, 0
+	if err := syncDir(ft.dir); err != nil {
+		return err
+	}
+	if err := ft.compact(); err != nil {
+		slog.Warn("error compacting log", slog.String("dir", ft.dir), slog.Any("error", err))
+	}
+	return nil
+}
+
+func (ft *FileTransport) Receive(ctx context.Context) (*Delivery, error) { //REVIEW: messages not received before closing stay in the log for the next receiver
+	for {
+		ft.mutex.Lock()
+		if ft.closed {
+			ft.mutex.Unlock()
+			return nil, ErrTransportClosed
+		}
+		if err := ctx.Err(); err != nil {
+			ft.mutex.Unlock()
+			return nil, err
+		}
+		if !ft.consuming {
+			if err := ft.lockReceiver(); err != nil {
+				ft.mutex.Unlock()
+				return nil, err
+			}
+			committed, err := readWalOffset(ft.dir)
+			if err != nil {
+				ft.mutex.Unlock()
+				return nil, err
+			}
+			ft.committed, ft.position, ft.consuming = committed, committed, true
+		}
+		var entry *walEntry
+		if len(ft.ready) > 0 {
+			entry, ft.ready = ft.ready[0], ft.ready[1:]
+		} else {
+			var err error
+			if entry, err = ft.next(); err != nil {
+				ft.mutex.Unlock()
+				return nil, err
+			}
+		}
+		if entry != nil {
+			delivery := ft.deliver(entry)
+			ft.mutex.Unlock()
+			return delivery, nil
+		}
+		ft.mutex.Unlock()
+
+		select {
+		case <-ft.wake:
+		case <-ft.done:
+		case <-ctx.Done():
+		case <-time.After(ft.config.pollInterval):
+		}
+	}
+}
+
+func (ft *FileTransport) next() (*walEntry, error) { //REVIEW: reads the record at the current position, nil when it was not fully written yet
+	for {
+		if ft.reader == nil {
+			segments, err := walSegments(ft.dir)
+			if err != nil || len(segments) == 0 {
+				return nil, err
+			}
+			index := 0
+			if ft.position < segments[0] { //REVIEW: the segments were removed by the retention before being consumed
+				slog.Warn("skipping expired log records", slog.Int64("from", ft.position), slog.Int64("to", segments[0]))
+				ft.position = segments[0]
+			} else {
+				index, _ = slices.BinarySearch(segments, ft.position+1)
+				index--
+			}
+			reader, err := os.Open(ft.segmentPath(segments[index]))
+			if err != nil {
+				return nil, err
+			}
+			ft.reader, ft.readerBase = reader, segments[index]
+		}
+
+		message, err := readWalRecord(ft.reader, ft.position-ft.readerBase)
+		if err == nil {
+			entry := &walEntry{offset: ft.position, message: message}
+			ft.position += walHeaderSize + int64(len(message))
+			return entry, nil
+		}
+		if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, ErrCorruptRecord) {
+			return nil, err
+		}
+		segments, err := walSegments(ft.dir)
+		if err != nil {
+			return nil, err
+		}
+		index, _ := slices.BinarySearch(segments, ft.readerBase+1)
+		if index == len(segments) { //REVIEW: the active segment, the record is still being written
+			return nil, nil
+		}
+		if message, err := readWalRecord(ft.reader, ft.position-ft.readerBase); err == nil { //REVIEW: the record may have been completed and the segment sealed since the first read, it is only corrupt if it still can not be read now that it has a successor
+			entry := &walEntry{offset: ft.position, message: message}
+			ft.position += walHeaderSize + int64(len(message))
+			return entry, nil
+		}
+		if next := segments[index]; next != ft.position { //REVIEW: sealed segments are only followed by another once complete, anything left is corrupt
+			slog.Error("skipping corrupt log records", slog.Int64("from", ft.position), slog.Int64("to", next), slog.Any("error", err))
+		}
+		_ = ft.reader.Close()
+		ft.reader, ft.position = nil, segments[index]
+	}
+}
+
+func (ft *FileTransport) deliver(entry *walEntry) *Delivery {
+	entry.attempts++
+	ft.lease++
+	lease := ft.lease
+	ft.inflight[lease] = entry
+	entry.timer = time.AfterFunc(ft.config.visibilityTimeout, func() { _ = ft.settle(lease, false) })
+	return NewDelivery(entry.message, entry.attempts, func(ack bool) error { return ft.settle(lease, ack) })
+}
+
+func (ft *FileTransport) settle(lease uint64, ack bool) error {
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+	entry, ok := ft.inflight[lease]
+	if !ok {
+		return ErrDeliveryExpired
+	}
+	delete(ft.inflight, lease)
+	entry.timer.Stop()
+	if !ack {
+		ft.ready = append([]*walEntry{entry}, ft.ready...)
+		ft.signal()
+		return nil
+	}
+	return ft.commit()
+}
+
+func (ft *FileTransport) commit() error { //REVIEW: the offset only moves past records acknowledged in order, records acknowledged out of order are delivered again after a restart
+	committed := ft.position
+	for _, entry := range ft.ready {
+		committed = min(committed, entry.offset)
+	}
+	for _, entry := range ft.inflight {
+		committed = min(committed, entry.offset)
+	}
+	if committed <= ft.committed {
+		return nil
+	}
+	if err := writeWalOffset(ft.dir, committed); err != nil {
+		return err
+	}
+	ft.committed = committed
+	if ft.compacted < ft.readerBase && committed >= ft.readerBase { //REVIEW: every segment before the one being read was consumed
+		ft.compacted = ft.readerBase
+		if err := ft.compact(); err != nil {
+			slog.Warn("error compacting log", slog.String("dir", ft.dir), slog.Any("error", err))
+		}
+	}
+	return nil
+}
+
+func (ft *FileTransport) Compact() error { //REVIEW: removes the sealed segments that were consumed or outlived the retention, the active segment is always kept
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+	return ft.compact()
+}
+
+func (ft *FileTransport) compact() error {
+	committed := ft.committed
+	if !ft.consuming { //REVIEW: sending processes learn the consumed offset from the receiving one
+		var err error
+		if committed, err = readWalOffset(ft.dir); err != nil {
+			return err
+		}
+	}
+	segments, err := walSegments(ft.dir)
+	if err != nil {
+		return err
+	}
+	var failures []error
+	for i := 0; i+1 < len(segments); i++ {
+		path := ft.segmentPath(segments[i])
+		consumed := segments[i+1] <= committed
+		expired := false
+		if info, err := os.Stat(path); err == nil && ft.config.retention > 0 {
+			expired = time.Since(info.ModTime()) > ft.config.retention
+		}
+		if !consumed && !expired {
+			continue
+		}
+		if !consumed {
+			slog.Warn("removing unconsumed log segment past its retention", slog.Int64("segment", segments[i]))
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			failures = append(failures, err)
+		}
+	}
+	return errors.Join(failures...)
+}
+
+func (ft *FileTransport) signal() {
+	select {
+	case ft.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (ft *FileTransport) Close() error { //REVIEW: deliveries received before closing can still be acknowledged
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+	if ft.closed {
+		return nil
+	}
+	ft.closed = true
+	close(ft.done)
+	var failures []error
+	for _, file := range []*os.File{ft.writer, ft.reader, ft.lock, ft.receiver} {
+		if file != nil {
+			failures = append(failures, file.Close())
+		}
+	}
+	return errors.Join(failures...)
+}
+
+func (ft *FileTransport) segmentPath(base int64) string {
+	return filepath.Join(ft.dir, fmt.Sprintf("%020d%s", base, walSegmentExt))
+}
+
+func walSegments(dir string) ([]int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []int64
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), walSegmentExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if base, err := strconv.ParseInt(name, 10, 64); err == nil {
+			segments = append(segments, base)
+		}
+	}
+	slices.Sort(segments)
+	return segments, nil
+}
+
+func readWalRecord(file *os.File, position int64) ([]byte, error) {
+	var header [walHeaderSize]byte
+	if _, err := file.ReadAt(header[:], position); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length > walMaxRecordSize {
+		return nil, fmt.Errorf("%w: length %d at %d", ErrCorruptRecord, length, position)
+	}
+	message := make([]byte, length)
+	if _, err := file.ReadAt(message, position+walHeaderSize); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(message, walTable) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch at %d", ErrCorruptRecord, position)
+	}
+	return message, nil
+}
+
+func walValidSize(file *os.File, position int64) (int64, error) { //REVIEW: end of the records that can be read back from the position, anything after them was torn
+	for {
+		message, err := readWalRecord(file, position)
+		switch {
+		case err == nil:
+			position += walHeaderSize + int64(len(message))
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, ErrCorruptRecord):
+			return position, nil
+		default:
+			return 0, err
+		}
+	}
+}
+
+func readWalOffset(dir string) (int64, error) {
+	content, err := os.ReadFile(filepath.Join(dir, walOffsetFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+}
+
+func writeWalOffset(dir string, offset int64) error {
+	path := filepath.Join(dir, walOffsetFile)
+	temporary := path + ".tmp"
+	file, err := os.Create(temporary)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(strconv.FormatInt(offset, 10))
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(temporary, path) //REVIEW: the offset is never read half written
+}
+
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := file.Sync(); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+	return nil
+}
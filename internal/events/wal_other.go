@@ -0,0 +1,22 @@
+//go:build !unix
+
+package events
+
+import (
+	"errors"
+	"os"
+)
+
+const fileLocksSupported = false //REVIEW: without advisory locks concurrent senders and receivers would corrupt the log, OpenFileTransport fails instead
+
+func lockFile(*os.File) error {
+	return errors.ErrUnsupported
+}
+
+func tryLockFile(*os.File) error {
+	return errors.ErrUnsupported
+}
+
+func unlockFile(*os.File) error {
+	return errors.ErrUnsupported
+}
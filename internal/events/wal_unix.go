@@ -0,0 +1,27 @@
+//go:build unix
+
+package events
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+const fileLocksSupported = true
+
+func lockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+}
+
+func tryLockFile(file *os.File) error {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrReceiverLocked
+	}
+	return err
+}
+
+func unlockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,163 @@
+package grpc
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	errs "github.com/vfcoelho/go-project-pocs/internal/errors"
+	googlegrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	MetadataCorrelationID  = "x-correlation-id"
+	MetadataRequestID      = "x-request-id"
+	MetadataAcceptLanguage = "accept-language"
+)
+
+type interceptorConfig struct {
+	registry    *errs.Registry
+	statusCodes map[errs.ErrorCode]codes.Code
+	catalog     *errs.Catalog
+	logger      *slog.Logger
+	observer    errs.Observer
+	production  bool
+}
+
+type InterceptorOption func(*interceptorConfig) //REVIEW: provides with-builder methods to configure the error interceptors, grpc has no locals so options replace the fiber Set* middlewares
+func WithErrorRegistry(registry *errs.Registry) InterceptorOption {
+	return func(ic *interceptorConfig) {
+		ic.registry = registry
+	}
+}
+func WithStatusCodes(statusCodes map[errs.ErrorCode]codes.Code) InterceptorOption { //REVIEW: grpc codes of the error codes, children codes use the code of their nearest mapped ancestor
+	return func(ic *interceptorConfig) {
+		ic.statusCodes = statusCodes
+	}
+}
+func WithMessageCatalog(catalog *errs.Catalog) InterceptorOption {
+	return func(ic *interceptorConfig) {
+		ic.catalog = catalog
+	}
+}
+func WithLogger(logger *slog.Logger) InterceptorOption {
+	return func(ic *interceptorConfig) {
+		ic.logger = logger
+	}
+}
+func WithErrorObserver(observer errs.Observer) InterceptorOption {
+	return func(ic *interceptorConfig) {
+		ic.observer = observer
+	}
+}
+func WithProductionMode() InterceptorOption {
+	return func(ic *interceptorConfig) {
+		ic.production = true
+	}
+}
+
+func newInterceptorConfig(opts []InterceptorOption) interceptorConfig {
+	config := interceptorConfig{registry: errs.DefaultRegistry, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+func UnaryErrorInterceptor(opts ...InterceptorOption) googlegrpc.UnaryServerInterceptor { //REVIEW: mirrors the fiber ErrorRecoverMiddleware - all errors will return a readable status to the caller
+	config := newInterceptorConfig(opts)
+	return func(ctx context.Context, req any, info *googlegrpc.UnaryServerInfo, handler googlegrpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = fmt.Errorf("panic: %v", recovered)
+			}
+			if err != nil {
+				var id string
+				err, id = config.statusError(ctx, info.FullMethod, err)
+				_ = googlegrpc.SetHeader(ctx, metadata.Pairs(MetadataCorrelationID, id))
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+func StreamErrorInterceptor(opts ...InterceptorOption) googlegrpc.StreamServerInterceptor {
+	config := newInterceptorConfig(opts)
+	return func(srv any, ss googlegrpc.ServerStream, info *googlegrpc.StreamServerInfo, handler googlegrpc.StreamHandler) (err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = fmt.Errorf("panic: %v", recovered)
+			}
+			if err != nil {
+				var id string
+				err, id = config.statusError(ss.Context(), info.FullMethod, err)
+				_ = ss.SetHeader(metadata.Pairs(MetadataCorrelationID, id))
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+func (ic interceptorConfig) statusError(ctx context.Context, method string, err error) (error, string) {
+	var rpcErr errs.Error
+	if _, isStatus := status.FromError(err); isStatus && !errors.As(err, &rpcErr) {
+		return err, uuid.NewString() //REVIEW: errors that already are grpc statuses are kept, like fiber errors on the http middleware
+	}
+	errs.Observe(ic.observer, err, errs.TransportGRPC, method)
+	if !errors.As(err, &rpcErr) {
+		rpcErr = errs.NewError(err)
+	}
+
+	definition, defined := ic.registry.Definition(err)
+	_, mapped := ic.statusCode(definition.Code) //REVIEW: a code is only mapped when it or an ancestor defines a grpc code, registered namespaces alone do not make internal details public
+	mapped = defined && mapped
+	id := uuid.NewString() //REVIEW: the correlation id is always generated, the caller id is only kept as a validated request id
+	rpcErr.CorrelationID = id
+	rpcErr.RequestID = requestID(ctx)
+	rpcErr.Class = ic.registry.Classify(err)
+	rpcErr.RetryAfter, _ = ic.registry.RetryAfter(err)
+
+	level := lo.Ternary(defined, definition.Severity.Level(), slog.LevelError)
+	ic.logger.Log(ctx, level, err.Error(), //REVIEW: the full internal error is only logged, matched to the status by the correlation id
+		slog.String("correlation_id", id),
+		slog.String("method", method),
+		slog.Any("error", rpcErr),
+	)
+
+	if ic.production && !mapped {
+		rpcErr = errs.Error{Code: rpcErr.Code, CorrelationID: id, RequestID: rpcErr.RequestID, Class: rpcErr.Class, RetryAfter: rpcErr.RetryAfter} //REVIEW: unmapped errors may carry internal details, only the code and the retry semantics are kept
+	}
+	if rpcErr.Message == "" { //REVIEW: explicit messages win over localized ones, which win over the registry default
+		rpcErr.Message = cmp.Or(ic.localizedMessage(ctx, rpcErr), definition.Message, "internal error")
+	}
+	return ic.toStatus(rpcErr).Err(), id
+}
+
+func (ic interceptorConfig) localizedMessage(ctx context.Context, rpcErr errs.Error) string {
+	if ic.catalog == nil || rpcErr.Code == "" {
+		return ""
+	}
+	locale := ic.catalog.Negotiate(incomingMetadata(ctx, MetadataAcceptLanguage))
+	message, _ := ic.catalog.Message(locale, rpcErr.Code, ic.registry.Redact(rpcErr.Code, rpcErr.Data, errs.TargetResponse)) //REVIEW: placeholders must not leak redacted data
+	return message
+}
+
+func requestID(ctx context.Context) string { //REVIEW: invalid caller ids are dropped instead of being echoed back
+	id := cmp.Or(incomingMetadata(ctx, MetadataRequestID), incomingMetadata(ctx, MetadataCorrelationID))
+	return lo.Ternary(errs.ValidRequestID(id), id, "")
+}
+
+func incomingMetadata(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,189 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/vfcoelho/go-project-pocs/internal"
+	errs "github.com/vfcoelho/go-project-pocs/internal/errors"
+	googlegrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type GrpcTestSuite struct {
+	suite.Suite
+}
+
+func TestGrpcTestSuite(t *testing.T) {
+	suite.Run(t, new(GrpcTestSuite))
+}
+
+type testStream struct {
+	googlegrpc.ServerStream
+	ctx    context.Context
+	header metadata.MD
+}
+
+func (ts *testStream) Context() context.Context {
+	return ts.ctx
+}
+func (ts *testStream) SetHeader(md metadata.MD) error {
+	ts.header = metadata.Join(ts.header, md)
+	return nil
+}
+
+func (suite *GrpcTestSuite) TestUnaryErrorInterceptor() {
+
+	info := &googlegrpc.UnaryServerInfo{FullMethod: "/record.v1.RecordService/Get"}
+	incoming := func(pairs ...string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+	}
+
+	type testCase struct {
+		Options     []InterceptorOption
+		Context     context.Context
+		Handler     googlegrpc.UnaryHandler
+		WantCode    codes.Code
+		WantMessage string
+		Want        errs.Error
+	}
+
+	TestCase := func(name string, useCase testCase) (string, func()) {
+		return name, func() {
+			options := append([]InterceptorOption{WithErrorRegistry(internal.REGISTRY), WithStatusCodes(internal.GRPC_CODES), WithLogger(slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil)))}, useCase.Options...)
+			_, err := UnaryErrorInterceptor(options...)(useCase.Context, nil, info, useCase.Handler)
+
+			st, _ := status.FromError(err)
+			decoded := FromStatus(st, WithErrorRegistry(internal.REGISTRY))
+			assert.NotEmpty(suite.T(), decoded.CorrelationID)
+			decoded.CorrelationID = ""
+
+			assert.Equal(suite.T(), useCase.WantCode, st.Code())
+			assert.Equal(suite.T(), useCase.WantMessage, st.Message())
+			assert.Equal(suite.T(), useCase.Want, decoded)
+		}
+	}
+
+	suite.Run(TestCase("should convert custom errors with their localized message", testCase{
+		Options: []InterceptorOption{WithMessageCatalog(internal.CATALOG)},
+		Context: incoming(MetadataAcceptLanguage, "pt-BR"),
+		Handler: func(ctx context.Context, req any) (any, error) {
+			return nil, errs.NewError(errors.New("id already exists"), errs.WithCode(internal.RECORD_ALREADY_EXISTS_ERROR))
+		},
+		WantCode:    codes.AlreadyExists,
+		WantMessage: "id already exists",
+		Want: errs.Error{
+			Err:     errors.New("id already exists"),
+			Code:    internal.RECORD_ALREADY_EXISTS_ERROR,
+			Message: "Já existe um registro com o mesmo id",
+			Class:   errs.ClassConflict,
+		},
+	}))
+	suite.Run(TestCase("should keep internal causes of raw errors outside production mode", testCase{
+		Context: context.Background(),
+		Handler: func(ctx context.Context, req any) (any, error) {
+			return nil, errors.New("id cannot be nil")
+		},
+		WantCode:    codes.Internal,
+		WantMessage: "id cannot be nil",
+		Want: errs.Error{
+			Err:     errors.New("id cannot be nil"),
+			Message: "internal error",
+		},
+	}))
+	suite.Run(TestCase("should hide internal causes of raw errors in production mode", testCase{
+		Options: []InterceptorOption{WithProductionMode()},
+		Context: context.Background(),
+		Handler: func(ctx context.Context, req any) (any, error) {
+			return nil, errors.New("id cannot be nil")
+		},
+		WantCode:    codes.Internal,
+		WantMessage: "internal error",
+		Want: errs.Error{
+			Err:     errors.New("internal error"),
+			Message: "internal error",
+		},
+	}))
+	suite.Run(TestCase("should send the public message of mapped errors in production mode", testCase{
+		Options: []InterceptorOption{WithProductionMode()},
+		Context: context.Background(),
+		Handler: func(ctx context.Context, req any) (any, error) {
+			return nil, errs.NewError(errors.New("id already exists"), errs.WithCode(internal.RECORD_ALREADY_EXISTS_ERROR))
+		},
+		WantCode:    codes.AlreadyExists,
+		WantMessage: "record already exists",
+		Want: errs.Error{
+			Err:     errors.New("record already exists"),
+			Code:    internal.RECORD_ALREADY_EXISTS_ERROR,
+			Message: "record already exists",
+			Class:   errs.ClassConflict,
+		},
+	}))
+	suite.Run(TestCase("should recover panics as internal errors", testCase{
+		Options: []InterceptorOption{WithProductionMode()},
+		Context: context.Background(),
+		Handler: func(ctx context.Context, req any) (any, error) {
+			panic("unexpected")
+		},
+		WantCode:    codes.Internal,
+		WantMessage: "internal error",
+		Want: errs.Error{
+			Err:     errors.New("internal error"),
+			Message: "internal error",
+		},
+	}))
+
+	suite.Run("should keep grpc status errors and successful responses", func() {
+		interceptor := UnaryErrorInterceptor()
+		_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+			return nil, status.Error(codes.PermissionDenied, "denied")
+		})
+		assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+
+		resp, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+			return "response", nil
+		})
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), "response", resp)
+	})
+	suite.Run("should notify the error observer with the method", func() {
+		metrics := errs.NewMetrics()
+		interceptor := UnaryErrorInterceptor(WithErrorObserver(metrics), WithLogger(slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))))
+		_, _ = interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+			return nil, errs.NewError(errors.New("not found"), errs.WithCode(internal.RECORD_NOT_FOUND_ERROR))
+		})
+
+		var buffer bytes.Buffer
+		_ = metrics.WritePrometheus(&buffer)
+		assert.Equal(suite.T(), uint64(1), metrics.Count(internal.RECORD_NOT_FOUND_ERROR))
+		assert.Contains(suite.T(), buffer.String(), `transport="grpc",route="/record.v1.RecordService/Get"`)
+	})
+}
+
+func (suite *GrpcTestSuite) TestStreamErrorInterceptor() {
+
+	info := &googlegrpc.StreamServerInfo{FullMethod: "/record.v1.RecordService/Watch"}
+
+	suite.Run("should convert custom errors and keep the caller id as the request id", func() {
+		stream := &testStream{ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataCorrelationID, "caller-correlation-id"))}
+		interceptor := StreamErrorInterceptor(WithErrorRegistry(internal.REGISTRY), WithStatusCodes(internal.GRPC_CODES), WithLogger(slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))))
+
+		err := interceptor(nil, stream, info, func(srv any, ss googlegrpc.ServerStream) error {
+			return errs.NewError(errors.New("record not found"), errs.WithCode(internal.RECORD_NOT_FOUND_ERROR))
+		})
+
+		st, _ := status.FromError(err)
+		assert.Equal(suite.T(), codes.NotFound, st.Code())
+		decoded := FromStatus(st, WithErrorRegistry(internal.REGISTRY))
+		assert.Equal(suite.T(), "caller-correlation-id", decoded.RequestID)
+		assert.NotEqual(suite.T(), "caller-correlation-id", decoded.CorrelationID)
+		assert.Equal(suite.T(), []string{decoded.CorrelationID}, stream.header.Get(MetadataCorrelationID))
+	})
+}
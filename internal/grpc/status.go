@@ -0,0 +1,129 @@
+package grpc
+
+import (
+	"encoding/json"
+	"errors"
+
+	errs "github.com/vfcoelho/go-project-pocs/internal/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+var StatusDomain = "go-project-pocs" //REVIEW: domain of the error info details, identifies the service emitting the error codes
+
+var classStatusCodes = map[errs.Class]codes.Code{ //REVIEW: default grpc codes of error classes, used when the error code has no mapped grpc code
+	errs.ClassTransient: codes.Unavailable,
+	errs.ClassThrottled: codes.ResourceExhausted,
+	errs.ClassConflict:  codes.Aborted,
+	errs.ClassPermanent: codes.FailedPrecondition,
+}
+
+var statusCodeClasses = map[codes.Code]errs.Class{
+	codes.Unavailable:       errs.ClassTransient,
+	codes.DeadlineExceeded:  errs.ClassTransient,
+	codes.ResourceExhausted: errs.ClassThrottled,
+	codes.Aborted:           errs.ClassConflict,
+}
+
+func (ic interceptorConfig) statusCode(code errs.ErrorCode) (statusCode codes.Code, ok bool) { //REVIEW: grpc code of the code or of its nearest ancestor mapping one
+	for _, ancestor := range code.Ancestors() {
+		if statusCode, ok = ic.statusCodes[ancestor]; ok {
+			return
+		}
+	}
+	return
+}
+
+func ToStatus(err error, opts ...InterceptorOption) *status.Status { //REVIEW: converts errors into grpc statuses, custom errors carry their code and data as error details
+	return newInterceptorConfig(opts).toStatus(err)
+}
+
+func (ic interceptorConfig) toStatus(err error) *status.Status {
+	var customErr errs.Error
+	if !errors.As(err, &customErr) {
+		return status.New(codes.Internal, ic.statusMessage(err.Error(), "internal error"))
+	}
+
+	statusCode, mapped := codes.Internal, false
+	if definition, ok := ic.registry.Definition(err); ok {
+		statusCode, mapped = ic.statusCode(definition.Code)
+	}
+	if !mapped {
+		statusCode = classStatusCodes[ic.registry.Classify(err)]
+	}
+	if statusCode == codes.OK {
+		statusCode = codes.Internal
+	}
+
+	message := customErr.Message
+	if customErr.Err != nil {
+		message = ic.statusMessage(customErr.Err.Error(), customErr.Message)
+	}
+	st := status.New(statusCode, message)
+
+	info := &errdetails.ErrorInfo{Reason: string(customErr.Code), Domain: StatusDomain, Metadata: make(map[string]string)}
+	if customErr.Message != "" {
+		info.Metadata["message"] = customErr.Message
+	}
+	if customErr.CorrelationID != "" {
+		info.Metadata["correlation_id"] = customErr.CorrelationID
+	}
+	if customErr.RequestID != "" {
+		info.Metadata["request_id"] = customErr.RequestID
+	}
+	if class := ic.registry.Classify(err); class != "" {
+		info.Metadata["class"] = string(class)
+	}
+	if customErr.Data != nil {
+		if data, err := json.Marshal(ic.registry.Redact(customErr.Code, customErr.Data, errs.TargetResponse)); err == nil {
+			info.Metadata["data"] = string(data)
+		}
+	}
+	if withDetails, err := st.WithDetails(info); err == nil {
+		st = withDetails
+	}
+	if delay, ok := ic.registry.RetryAfter(err); ok {
+		if withDetails, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)}); err == nil {
+			st = withDetails
+		}
+	}
+	return st
+}
+
+func (ic interceptorConfig) statusMessage(internal string, public string) string { //REVIEW: the internal cause is only sent outside production mode, like the problem details of the http middleware
+	if ic.production {
+		return public
+	}
+	return internal
+}
+
+func FromStatus(st *status.Status, opts ...InterceptorOption) errs.Error { //REVIEW: rebuilds custom errors from grpc statuses, data is unmarshalled into the type registered for the code
+	return newInterceptorConfig(opts).fromStatus(st)
+}
+
+func (ic interceptorConfig) fromStatus(st *status.Status) errs.Error {
+	he := errs.Error{Err: errors.New(st.Message())}
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			he.Code = ic.registry.Canonical(errs.ErrorCode(detail.GetReason()))
+			he.Message = detail.GetMetadata()["message"]
+			he.CorrelationID = detail.GetMetadata()["correlation_id"]
+			he.RequestID = detail.GetMetadata()["request_id"]
+			he.Class = errs.Class(detail.GetMetadata()["class"])
+			if data, ok := detail.GetMetadata()["data"]; ok {
+				if typed, err := ic.registry.UnmarshalData(he.Code, json.RawMessage(data)); err == nil {
+					he.Data = typed
+				}
+			}
+		case *errdetails.RetryInfo:
+			he.RetryAfter = detail.GetRetryDelay().AsDuration()
+		}
+	}
+	if he.Code == "" && he.Class == "" {
+		he.Class = statusCodeClasses[st.Code()]
+	}
+	return he
+}
@@ -0,0 +1,75 @@
+package grpc
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	errs "github.com/vfcoelho/go-project-pocs/internal/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (suite *GrpcTestSuite) TestStatusConversion() {
+
+	type testData struct {
+		ID int `json:"id"`
+	}
+	sentinelError := errors.New("test error")
+	const TEST_NAMESPACE errs.ErrorCode = "status_test"
+	const TEST_NOT_FOUND_CODE errs.ErrorCode = "status_test.not_found"
+	const TEST_UNMAPPED_CODE errs.ErrorCode = "status_test.unmapped"
+	const TEST_TRANSIENT_CODE errs.ErrorCode = "status_transient_test"
+
+	registry := WithErrorRegistry(errs.NewRegistry().MustRegister(
+		errs.CodeDefinition{Code: TEST_NAMESPACE},
+		errs.CodeDefinition{Code: TEST_NOT_FOUND_CODE, DataType: reflect.TypeFor[testData]()},
+		errs.CodeDefinition{Code: TEST_TRANSIENT_CODE, Class: errs.ClassTransient, RetryAfter: time.Second},
+	))
+	statusCodes := WithStatusCodes(map[errs.ErrorCode]codes.Code{TEST_NAMESPACE: codes.InvalidArgument, TEST_NOT_FOUND_CODE: codes.NotFound})
+
+	suite.Run("custom errors are converted with their mapped grpc code and details", func() {
+		err := fmt.Errorf("wrapper: %w", errs.NewError(sentinelError, errs.WithCode(TEST_NOT_FOUND_CODE), errs.WithData(testData{ID: 1}), errs.WithMessage("public"), errs.WithCorrelationID("id")))
+		st := ToStatus(err, registry, statusCodes)
+
+		assert.Equal(suite.T(), codes.NotFound, st.Code())
+		assert.Equal(suite.T(), "test error", st.Message())
+
+		decoded := FromStatus(st, registry)
+		assert.Equal(suite.T(), TEST_NOT_FOUND_CODE, decoded.Code)
+		assert.Equal(suite.T(), testData{ID: 1}, decoded.Data)
+		assert.Equal(suite.T(), "public", decoded.Message)
+		assert.Equal(suite.T(), "id", decoded.CorrelationID)
+		assert.Equal(suite.T(), "test error", decoded.Err.Error())
+		assert.ErrorIs(suite.T(), decoded, errs.NewIsComparable(TEST_NAMESPACE))
+	})
+	suite.Run("the status message is the public message in production mode", func() {
+		err := errs.NewError(sentinelError, errs.WithCode(TEST_NOT_FOUND_CODE), errs.WithMessage("public"))
+		assert.Equal(suite.T(), "public", ToStatus(err, registry, statusCodes, WithProductionMode()).Message())
+		assert.Equal(suite.T(), "internal error", ToStatus(sentinelError, WithProductionMode()).Message())
+	})
+	suite.Run("codes without a grpc code use the nearest mapped ancestor", func() {
+		assert.Equal(suite.T(), codes.InvalidArgument, ToStatus(errs.NewError(sentinelError, errs.WithCode(TEST_UNMAPPED_CODE)), registry, statusCodes).Code())
+	})
+	suite.Run("classes define the grpc code and retry details of unmapped codes", func() {
+		st := ToStatus(errs.NewError(sentinelError, errs.WithCode(TEST_TRANSIENT_CODE)), registry, statusCodes)
+		assert.Equal(suite.T(), codes.Unavailable, st.Code())
+
+		decoded := FromStatus(st, registry)
+		assert.Equal(suite.T(), errs.ClassTransient, decoded.Class)
+		assert.Equal(suite.T(), time.Second, decoded.RetryAfter)
+
+		assert.Equal(suite.T(), codes.ResourceExhausted, ToStatus(errs.NewError(sentinelError, errs.WithClass(errs.ClassThrottled)), registry, statusCodes).Code())
+	})
+	suite.Run("unmapped and raw errors are internal", func() {
+		assert.Equal(suite.T(), codes.Internal, ToStatus(errs.NewError(sentinelError, errs.WithCode("other")), registry, statusCodes).Code())
+		assert.Equal(suite.T(), codes.Internal, ToStatus(sentinelError, registry, statusCodes).Code())
+	})
+	suite.Run("plain grpc statuses are classified by their code", func() {
+		decoded := FromStatus(status.New(codes.Unavailable, "unavailable"), registry)
+		assert.Equal(suite.T(), errs.ClassTransient, decoded.Class)
+		assert.True(suite.T(), errs.IsRetryable(decoded))
+	})
+}
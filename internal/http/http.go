@@ -1,58 +1,327 @@
 package http
 
 import (
+	"cmp"
 	"errors"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
 	internal "github.com/vfcoelho/go-project-pocs/internal"
 	errs "github.com/vfcoelho/go-project-pocs/internal/errors"
+	"github.com/vfcoelho/go-project-pocs/internal/events"
+	"github.com/vfcoelho/go-project-pocs/internal/outbox"
 	"github.com/vfcoelho/go-project-pocs/src/dtos"
 	"github.com/vfcoelho/go-project-pocs/src/handlers"
 	"github.com/vfcoelho/go-project-pocs/src/repositories"
 )
 
-func SetCodeErrorMappings(mappings map[errs.ErrorCode]int) func(*fiber.Ctx) error { //REVIEW: fiber middleware to set error mappings and later be used by the error response middleware
+const (
+	HeaderCorrelationID = "X-Correlation-ID"
+	HeaderRequestID     = "X-Request-ID"
+)
+
+var classStatuses = map[errs.Class]int{ //REVIEW: default statuses of error classes, used when the error code has no mapped status
+	errs.ClassTransient: fiber.StatusServiceUnavailable,
+	errs.ClassThrottled: fiber.StatusTooManyRequests,
+	errs.ClassConflict:  fiber.StatusConflict,
+}
+
+func SetErrorRegistry(registry *errs.Registry) func(*fiber.Ctx) error { //REVIEW: fiber middleware to set the error registry and later be used by the error response middleware
 	return func(c *fiber.Ctx) (err error) {
-		c.Locals("codeErrorMappings", mappings)
+		c.Locals("errorRegistry", registry)
 		return c.Next()
 	}
 }
 
+func getErrorRegistry(c *fiber.Ctx) *errs.Registry {
+	if registry, ok := c.Locals("errorRegistry").(*errs.Registry); ok && registry != nil {
+		return registry
+	}
+	return errs.DefaultRegistry
+}
+
+func SetErrorObserver(observer errs.Observer) func(*fiber.Ctx) error { //REVIEW: fiber middleware to inject the observer notified of every error handled by the error response middleware
+	return func(c *fiber.Ctx) (err error) {
+		c.Locals("errorObserver", observer)
+		return c.Next()
+	}
+}
+
+func SetTraceContext(c *fiber.Ctx) error { //REVIEW: fiber middleware to propagate the w3c trace context of the request to the events it produces
+	if traceParent := c.Get(events.HeaderTraceParent); traceParent != "" {
+		c.SetUserContext(events.WithTraceContext(c.UserContext(), events.TraceContext{Parent: traceParent, State: c.Get(events.HeaderTraceState)}))
+	}
+	return c.Next()
+}
+
+func SetCorrelationID(c *fiber.Ctx) error { //REVIEW: fiber middleware to propagate the id of the caller to the events it produces, invalid ids are dropped like in error responses
+	if id := requestID(c); id != "" {
+		c.SetUserContext(events.WithCorrelationID(c.UserContext(), id))
+	}
+	return c.Next()
+}
+
 func ErrorRecoverMiddleware(c *fiber.Ctx) (err error) { //REVIEW: error response middleware to handle proper response - all errors will return a readable response to the caller
 	err = c.Next()
 
 	if err != nil {
+		observer, _ := c.Locals("errorObserver").(errs.Observer)
+		errs.Observe(observer, err, errs.TransportHTTP, c.Method()+" "+c.Route().Path) //REVIEW: the route is the matched pattern, not the path, so ids do not explode the metrics cardinality
 		var httpErr errs.Error
 		var fiberErr *fiber.Error
 		switch {
 		case errors.As(err, &httpErr):
-			errorCode, ok := c.Locals("codeErrorMappings").(map[errs.ErrorCode]int)[httpErr.Code]
-			if !ok {
-				errorCode = fiber.StatusInternalServerError
-			}
-			return c.Status(errorCode).JSON(httpErr)
+			return respondError(c, httpErr, err)
 		case errors.As(err, &fiberErr):
-			return err
+			return respondFiberError(c, fiberErr)
 		default:
-			return c.Status(fiber.StatusInternalServerError).JSON(errs.NewError(err))
+			return respondError(c, errs.NewError(err), err)
 		}
 	}
 	return err
 }
 
-func SetupRouter(app *fiber.App, producer handlers.EventProducer[dtos.Record]) {
-	app.Use(recover.New())
-	app.Use(ErrorRecoverMiddleware)
-	app.Use(SetCodeErrorMappings(internal.MAPPING))
+func SetProductionMode(enabled bool) func(*fiber.Ctx) error { //REVIEW: fiber middleware to hide internal causes of unmapped errors from callers
+	return func(c *fiber.Ctx) (err error) {
+		c.Locals("productionMode", enabled)
+		return c.Next()
+	}
+}
+
+func SetDebugMode(enabled bool) func(*fiber.Ctx) error { //REVIEW: fiber middleware to expose the call site frames of errors to callers, it should be kept disabled in production
+	return func(c *fiber.Ctx) (err error) {
+		c.Locals("debugMode", enabled)
+		return c.Next()
+	}
+}
+
+func SetLogger(logger *slog.Logger) func(*fiber.Ctx) error { //REVIEW: fiber middleware to inject the logger used by the error response middleware
+	return func(c *fiber.Ctx) (err error) {
+		c.Locals("logger", logger)
+		return c.Next()
+	}
+}
+
+func getLogger(c *fiber.Ctx) *slog.Logger {
+	if logger, ok := c.Locals("logger").(*slog.Logger); ok && logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
+
+func SetMessageCatalog(catalog *errs.Catalog) func(*fiber.Ctx) error { //REVIEW: fiber middleware to localize error messages according to the Accept-Language header
+	return func(c *fiber.Ctx) (err error) {
+		c.Locals("messageCatalog", catalog)
+		return c.Next()
+	}
+}
+
+func localizedMessage(c *fiber.Ctx, code errs.ErrorCode, data any) (message string, locale string, ok bool) {
+	catalog, ok := c.Locals("messageCatalog").(*errs.Catalog)
+	if !ok || catalog == nil || code == "" {
+		return "", "", false
+	}
+	locale = catalog.Negotiate(c.Get(fiber.HeaderAcceptLanguage))
+	message, ok = catalog.Message(locale, code, data)
+	return
+}
+
+func requestID(c *fiber.Ctx) string { //REVIEW: the caller id is kept apart from the correlation id so errors can be traced across services without trusting it, invalid ids are dropped
+	id := cmp.Or(c.Get(HeaderRequestID), c.Get(HeaderCorrelationID))
+	return lo.Ternary(errs.ValidRequestID(id), id, "")
+}
+
+func respondError(c *fiber.Ctx, httpErr errs.Error, err error) error {
+	status := fiber.StatusInternalServerError
+	registry := getErrorRegistry(c)
+	definition, defined := registry.Definition(err)
+	codeStatus, mapped := registry.HTTPStatus(definition.Code) //REVIEW: a code is only mapped when it or an ancestor defines a status, registered namespaces alone do not make internal details public
+	mapped = defined && mapped
+	if mapped { //REVIEW: codes without a status of their own use the nearest mapped ancestor status
+		status = codeStatus
+	} else if classStatus, ok := classStatuses[registry.Classify(err)]; ok {
+		status = classStatus
+	}
+	if delay, ok := registry.RetryAfter(err); ok { //REVIEW: callers are told when a retryable failure is worth retrying
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+	}
+
+	id := uuid.NewString() //REVIEW: the correlation id is always generated so callers cannot forge or collide with another error occurrence
+	httpErr.CorrelationID = id
+	httpErr.RequestID = requestID(c)
+	level := lo.Ternary(defined, definition.Severity.Level(), slog.LevelError)
+	getLogger(c).Log(c.UserContext(), level, err.Error(), //REVIEW: the full internal error is only logged, matched to the response by the correlation id
+		slog.String("correlation_id", id),
+		slog.Int("status", status),
+		slog.String("method", c.Method()),
+		slog.String("path", c.Path()),
+		slog.Any("error", httpErr),
+	)
 
-	memoryRepository := repositories.NewMemoryRepository[*dtos.Record]()
+	if production, _ := c.Locals("productionMode").(bool); production && !mapped {
+		httpErr = errs.Error{Code: httpErr.Code, CorrelationID: id, RequestID: httpErr.RequestID} //REVIEW: unmapped errors may carry internal details, only the code is kept
+	}
+	if httpErr.Message == "" { //REVIEW: explicit messages win over localized ones, which win over the registry default
+		if message, locale, ok := localizedMessage(c, httpErr.Code, httpErr.RedactedData(errs.TargetResponse)); ok { //REVIEW: placeholders must not leak redacted data
+			httpErr.Message = message
+			c.Set(fiber.HeaderContentLanguage, locale)
+		} else {
+			httpErr.Message = lo.Ternary(definition.Message != "", definition.Message, utils.StatusMessage(status))
+		}
+	}
+	c.Set(HeaderCorrelationID, id)
+
+	debug, _ := c.Locals("debugMode").(bool)
+	if typeBaseURI, ok := acceptsProblem(c); ok {
+		title := lo.Ternary(definition.Message != "", definition.Message, utils.StatusMessage(status))
+		if message, locale, ok := localizedMessage(c, httpErr.Code, nil); ok && !strings.Contains(message, "{") { //REVIEW: localized messages with placeholders depend on the occurrence, they are only used as its detail
+			title = message
+			c.Set(fiber.HeaderContentLanguage, locale)
+		}
+		problem := NewProblem(httpErr, title, status, typeBaseURI, c.Path())
+		if frames := httpErr.Frames(); debug && len(frames) > 0 {
+			problem.Extensions["frames"] = frames
+		}
+		return c.Status(status).JSON(problem, MIMEApplicationProblemJSON)
+	}
+	if debug {
+		body, err := httpErr.MarshalJSONWith(errs.WithFrames())
+		if err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Status(status).Send(body)
+	}
+	return c.Status(status).JSON(httpErr)
+}
+
+func respondFiberError(c *fiber.Ctx, fiberErr *fiber.Error) error {
+	if _, ok := acceptsProblem(c); !ok {
+		return fiberErr //REVIEW: fiber renders its own errors for clients not asking for problem details
+	}
+	id := uuid.NewString()
+	c.Set(HeaderCorrelationID, id)
+	return c.Status(fiberErr.Code).JSON(NewFiberProblem(fiberErr, id, requestID(c), c.Path()), MIMEApplicationProblemJSON)
+}
+
+type routerConfig struct {
+	production      bool
+	debug           bool
+	logger          *slog.Logger
+	metrics         *errs.Metrics
+	metricsEndpoint bool
+	admin           *fiber.App
+	deadLetters     events.DeadLetterStore
+	redrive         events.Transport
+}
+
+type RouterOption func(*routerConfig) //REVIEW: provides with-builder methods to configure the router
+func WithProductionMode() RouterOption {
+	return func(rc *routerConfig) {
+		rc.production = true
+	}
+}
+
+func WithDebugMode() RouterOption {
+	return func(rc *routerConfig) {
+		rc.debug = true
+	}
+}
+
+func WithLogger(logger *slog.Logger) RouterOption {
+	return func(rc *routerConfig) {
+		rc.logger = logger
+	}
+}
+
+func WithAdminRouter(admin *fiber.App) RouterOption { //REVIEW: app the operational routes are mounted on, meant to be served on an internal listener. Without it they are not exposed
+	return func(rc *routerConfig) {
+		rc.admin = admin
+	}
+}
+
+func WithDeadLetters(store events.DeadLetterStore, transport events.Transport) RouterOption { //REVIEW: exposes the dead letters for inspection on the admin router, re-driven letters are sent through the transport
+	return func(rc *routerConfig) {
+		rc.deadLetters = store
+		rc.redrive = transport
+	}
+}
+
+func WithMetrics(metrics *errs.Metrics) RouterOption {
+	return func(rc *routerConfig) {
+		rc.metrics = metrics
+	}
+}
+
+func WithMetricsEndpoint() RouterOption { //REVIEW: mounts /metrics on the router, only meant for routers not reachable from outside, otherwise serve the metrics on an internal listener
+	return func(rc *routerConfig) {
+		rc.metricsEndpoint = true
+	}
+}
+
+func SetupRouter(app *fiber.App, store outbox.Store, opts ...RouterOption) { //REVIEW: the events of the records are stored in the outbox, publishing them is left to a relay run by the caller
+	config := routerConfig{logger: slog.Default(), metrics: errs.NewMetrics()}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	config.useMiddlewares(app)
+
+	memoryRepository := repositories.NewMemoryRepository(repositories.WithLogger[*dtos.Record](config.logger), repositories.WithOutbox[*dtos.Record](store))
 
 	app.Post("/v1/record", func(c *fiber.Ctx) error {
-		return handlers.Post(c, memoryRepository, producer)
+		return handlers.Post(c, memoryRepository)
 	})
 
 	app.Get("/v1/record/:id", func(c *fiber.Ctx) error {
 		return handlers.Get(c, memoryRepository)
 	})
+
+	if config.metricsEndpoint {
+		app.Get("/metrics", adaptor.HTTPHandler(config.metrics))
+	}
+
+	if config.admin == nil {
+		return
+	}
+	config.useMiddlewares(config.admin)
+	config.admin.Get("/v1/outbox", func(c *fiber.Ctx) error {
+		return handlers.ListOutbox(c, store)
+	})
+	config.admin.Get("/v1/outbox/:id", func(c *fiber.Ctx) error {
+		return handlers.GetOutboxEntry(c, store)
+	})
+	if deadLetters, transport := config.deadLetters, config.redrive; deadLetters != nil {
+		config.admin.Get("/v1/deadletters", func(c *fiber.Ctx) error {
+			return handlers.ListDeadLetters(c, deadLetters)
+		})
+		config.admin.Get("/v1/deadletters/:id", func(c *fiber.Ctx) error {
+			return handlers.GetDeadLetter(c, deadLetters)
+		})
+		config.admin.Post("/v1/deadletters/:id/redrive", func(c *fiber.Ctx) error {
+			return handlers.RedriveDeadLetter(c, deadLetters, transport)
+		})
+	}
+}
+
+func (rc routerConfig) useMiddlewares(app *fiber.App) { //REVIEW: the public and the admin routers handle errors alike
+	app.Use(recover.New())
+	app.Use(ErrorRecoverMiddleware)
+	app.Use(SetErrorRegistry(internal.REGISTRY))
+	app.Use(SetProductionMode(rc.production))
+	app.Use(SetDebugMode(rc.debug))
+	app.Use(SetLogger(rc.logger))
+	app.Use(SetProblemDetails("urn:go-project-pocs:error:"))
+	app.Use(SetMessageCatalog(internal.CATALOG))
+	app.Use(SetErrorObserver(rc.metrics))
+	app.Use(SetTraceContext)
+	app.Use(SetCorrelationID)
 }
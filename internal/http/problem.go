@@ -0,0 +1,121 @@
+package http
+
+import (
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/samber/lo"
+	errs "github.com/vfcoelho/go-project-pocs/internal/errors"
+)
+
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+var reservedMembers = map[string]bool{ //REVIEW: members set by the problem itself, error data cannot overwrite them
+	"type":           true,
+	"title":          true,
+	"status":         true,
+	"detail":         true,
+	"instance":       true,
+	"code":           true,
+	"correlation_id": true,
+	"request_id":     true,
+	"frames":         true,
+}
+
+type Problem struct { //REVIEW: RFC 7807 problem details document, extension members are flattened next to the standard ones
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]any
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	document := make(map[string]any, len(p.Extensions)+5)
+	for key, value := range p.Extensions {
+		document[key] = value
+	}
+	document["type"] = p.Type
+	document["title"] = p.Title
+	document["status"] = p.Status
+	if p.Detail != "" {
+		document["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		document["instance"] = p.Instance
+	}
+	return json.Marshal(document)
+}
+
+func NewProblem(err errs.Error, title string, status int, typeBaseURI string, instance string) Problem { //REVIEW: the title is the same for every occurrence of the code, the message of the occurrence is its detail and the internal cause is never exposed
+	problem := Problem{
+		Type:       "about:blank",
+		Title:      lo.Ternary(title != "", title, utils.StatusMessage(status)),
+		Status:     status,
+		Instance:   instance,
+		Extensions: make(map[string]any),
+	}
+	if err.Code != "" {
+		problem.Type = typeBaseURI + string(err.Code) //REVIEW: each error code has its own problem type
+		problem.Extensions["code"] = err.Code
+	}
+	if err.Message != problem.Title {
+		problem.Detail = err.Message
+	}
+	if err.CorrelationID != "" {
+		problem.Extensions["correlation_id"] = err.CorrelationID
+	}
+	if err.RequestID != "" {
+		problem.Extensions["request_id"] = err.RequestID
+	}
+	if err.Data != nil {
+		redacted := err.RedactedData(errs.TargetResponse)
+		problem.Extensions["data"] = redacted
+		if data, jsonErr := json.Marshal(redacted); jsonErr == nil {
+			var members map[string]any
+			if json.Unmarshal(data, &members) == nil { //REVIEW: object data is exposed as extension members, any other data is kept under "data"
+				delete(problem.Extensions, "data")
+				for key, value := range members {
+					if !reservedMembers[key] {
+						problem.Extensions[key] = value
+					}
+				}
+			}
+		}
+	}
+	return problem
+}
+
+func NewFiberProblem(err *fiber.Error, correlationID string, requestID string, instance string) Problem { //REVIEW: fiber errors carry a status and a message meant for the caller, there is no code to resolve
+	problem := Problem{
+		Type:       "about:blank",
+		Title:      utils.StatusMessage(err.Code),
+		Status:     err.Code,
+		Instance:   instance,
+		Extensions: map[string]any{"correlation_id": correlationID},
+	}
+	if requestID != "" {
+		problem.Extensions["request_id"] = requestID
+	}
+	if err.Message != problem.Title {
+		problem.Detail = err.Message
+	}
+	return problem
+}
+
+func SetProblemDetails(typeBaseURI string) func(*fiber.Ctx) error { //REVIEW: fiber middleware that enables problem details responses for clients accepting them
+	return func(c *fiber.Ctx) (err error) {
+		c.Locals("problemTypeBaseURI", typeBaseURI)
+		return c.Next()
+	}
+}
+
+func acceptsProblem(c *fiber.Ctx) (typeBaseURI string, ok bool) {
+	typeBaseURI, ok = c.Locals("problemTypeBaseURI").(string)
+	if !ok {
+		return
+	}
+	return typeBaseURI, c.Accepts(fiber.MIMEApplicationJSON, MIMEApplicationProblemJSON) == MIMEApplicationProblemJSON //REVIEW: legacy json stays the default for clients that do not explicitly ask for problem details
+}
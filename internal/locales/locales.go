@@ -0,0 +1,6 @@
+package locales
+
+import "embed"
+
+//go:embed *.json
+var FS embed.FS //REVIEW: error message catalogs, one file per locale, embedded so the binaries carry their own translations
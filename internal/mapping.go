@@ -1,16 +1,11 @@
 package internal
 
 import (
-	"github.com/gofiber/fiber/v2"
 	"github.com/vfcoelho/go-project-pocs/internal/errors"
+	"github.com/vfcoelho/go-project-pocs/internal/locales"
 )
 
-const (
-	RECORD_ALREADY_EXISTS_ERROR errors.ErrorCode = "record_already_exists"
-	RECORD_NOT_FOUND_ERROR      errors.ErrorCode = "record_not_found"
-)
+//go:generate go run ../cmd/errgen -catalog errors.yaml -go mapping_gen.go -docs ../docs/errors.md -schemas ../docs/schemas
+//REVIEW: error codes, their data types and their registry are generated from errors.yaml so they are declared once for the whole project
 
-var MAPPING = map[errors.ErrorCode]int{ //REVIEW: possible errors and their default codes would be defined in a separate file in order to be used by the whole project
-	RECORD_NOT_FOUND_ERROR:      fiber.StatusNotFound,
-	RECORD_ALREADY_EXISTS_ERROR: fiber.StatusConflict,
-}
+var CATALOG = errors.MustLoadCatalog(locales.FS, "en", REGISTRY) //REVIEW: localized messages are validated against the registry at startup
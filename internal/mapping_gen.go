@@ -0,0 +1,90 @@
+// Code generated by errgen. DO NOT EDIT.
+
+package internal
+
+import (
+	"reflect"
+
+	"github.com/google/uuid"
+	"github.com/vfcoelho/go-project-pocs/internal/errors"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	RECORD_ERROR                 errors.ErrorCode = "record"                         // Namespace of every record error, can be used to match any of them.
+	RECORD_CONFLICT_ERROR        errors.ErrorCode = "record.conflict"                // The record conflicts with its current state.
+	RECORD_ALREADY_EXISTS_ERROR  errors.ErrorCode = "record.conflict.already_exists" // A record with the same id already exists, the http status is inherited from record.conflict while the grpc code is more specific.
+	RECORD_NOT_FOUND_ERROR       errors.ErrorCode = "record.not_found"               // The requested record does not exist.
+	DEAD_LETTER_NOT_FOUND_ERROR  errors.ErrorCode = "dead_letter.not_found"          // The requested dead letter does not exist or was already re-driven.
+	OUTBOX_ENTRY_NOT_FOUND_ERROR errors.ErrorCode = "outbox.entry_not_found"         // The requested outbox entry does not exist or was already published.
+)
+
+// Data carried by errors that refer to a single record.
+type RecordIDData struct {
+	ID uuid.UUID `json:"id"` // Id of the record.
+}
+
+// Data carried by errors that refer to a single dead letter.
+type DeadLetterIDData struct {
+	ID string `json:"id"` // Id of the dead letter.
+}
+
+// Data carried by errors that refer to a single outbox entry.
+type OutboxEntryIDData struct {
+	ID string `json:"id"` // Id of the outbox entry.
+}
+
+var REGISTRY = errors.DefaultRegistry.MustRegister(
+	errors.CodeDefinition{
+		Code:     RECORD_ERROR,
+		Severity: errors.SeverityError,
+		Message:  "record error",
+	},
+	errors.CodeDefinition{
+		Code:       RECORD_CONFLICT_ERROR,
+		HTTPStatus: 409,
+		Class:      errors.ClassConflict,
+		Severity:   errors.SeverityWarning,
+		Message:    "record conflict",
+	},
+	errors.CodeDefinition{
+		Code:     RECORD_ALREADY_EXISTS_ERROR,
+		Severity: errors.SeverityWarning,
+		Message:  "record already exists",
+		Aliases:  []errors.ErrorCode{"record_already_exists"},
+	},
+	errors.CodeDefinition{
+		Code:       RECORD_NOT_FOUND_ERROR,
+		HTTPStatus: 404,
+		Class:      errors.ClassPermanent,
+		Severity:   errors.SeverityWarning,
+		Message:    "record not found",
+		DataType:   reflect.TypeFor[RecordIDData](),
+		Aliases:    []errors.ErrorCode{"record_not_found"},
+	},
+	errors.CodeDefinition{
+		Code:       DEAD_LETTER_NOT_FOUND_ERROR,
+		HTTPStatus: 404,
+		Class:      errors.ClassPermanent,
+		Severity:   errors.SeverityInfo,
+		Message:    "dead letter not found",
+		DataType:   reflect.TypeFor[DeadLetterIDData](),
+	},
+	errors.CodeDefinition{
+		Code:       OUTBOX_ENTRY_NOT_FOUND_ERROR,
+		HTTPStatus: 404,
+		Class:      errors.ClassPermanent,
+		Severity:   errors.SeverityInfo,
+		Message:    "outbox entry not found",
+		DataType:   reflect.TypeFor[OutboxEntryIDData](),
+	},
+)
+
+// grpc codes of the error codes, children codes use the code of their nearest mapped ancestor.
+var GRPC_CODES = map[errors.ErrorCode]codes.Code{
+	RECORD_CONFLICT_ERROR:        codes.Aborted,
+	RECORD_ALREADY_EXISTS_ERROR:  codes.AlreadyExists,
+	RECORD_NOT_FOUND_ERROR:       codes.NotFound,
+	DEAD_LETTER_NOT_FOUND_ERROR:  codes.NotFound,
+	OUTBOX_ENTRY_NOT_FOUND_ERROR: codes.NotFound,
+}
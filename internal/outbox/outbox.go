@@ -0,0 +1,330 @@
+package outbox
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrEntryNotFound = errors.New("outbox entry not found")
+
+type Entry struct { //REVIEW: an event waiting to be published, serialized when it was stored so later changes to the record do not leak into it
+	ID            string            `json:"id"`
+	Payload       json.RawMessage   `json:"payload,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"` // sent with the event when the producer supports headers, e.g. the trace context of the request storing it
+	CreatedAt     time.Time         `json:"created_at"`
+	Attempts      int               `json:"attempts"`
+	LastError     string            `json:"last_error,omitempty"`
+	LastAttemptAt *time.Time        `json:"last_attempt_at,omitempty"`
+	Quarantined   bool              `json:"quarantined,omitempty"` // moved out of the pending entries, it will never be published
+}
+
+func NewEntry(event any, headers map[string]string) (Entry, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return Entry{}, fmt.Errorf("error serializing outbox event: %w", err)
+	}
+	return Entry{ID: uuid.NewString(), Payload: payload, Headers: headers, CreatedAt: time.Now().UTC()}, nil
+}
+
+type Store interface {
+	Add(entries ...Entry) error
+	Pending(limit int) ([]Entry, error) // oldest entries first, every entry when limit is not positive
+	Get(id string) (Entry, error)
+	MarkSent(id string) error
+	MarkFailed(id string, cause error) error
+	Quarantine(id string, cause error) error // for entries that can never be published, they no longer hold back the ones after them
+	Quarantined(limit int) ([]Entry, error)
+}
+
+type MemoryStore struct { //REVIEW: in memory outbox, repositories add entries while holding their own write lock so records and events are stored together
+	mutex       sync.RWMutex
+	entries     map[string]Entry
+	quarantined map[string]Entry
+	notify      chan struct{}
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Entry), quarantined: make(map[string]Entry), notify: make(chan struct{}, 1)}
+}
+
+func (ms *MemoryStore) Add(entries ...Entry) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	for _, entry := range entries {
+		ms.entries[entry.ID] = entry
+	}
+	notify(ms.notify)
+	return nil
+}
+
+func (ms *MemoryStore) Notifications() <-chan struct{} { //REVIEW: signaled when entries are added, so the relay does not wait for its next poll
+	return ms.notify
+}
+
+func (ms *MemoryStore) Pending(limit int) ([]Entry, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	return oldest(values(ms.entries), limit), nil
+}
+
+func (ms *MemoryStore) Quarantined(limit int) ([]Entry, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	return oldest(values(ms.quarantined), limit), nil
+}
+
+func (ms *MemoryStore) Get(id string) (Entry, error) { //REVIEW: pending or quarantined entry
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	if entry, ok := ms.entries[id]; ok {
+		return entry, nil
+	}
+	if entry, ok := ms.quarantined[id]; ok {
+		return entry, nil
+	}
+	return Entry{}, fmt.Errorf("%w: %s", ErrEntryNotFound, id)
+}
+
+func (ms *MemoryStore) MarkSent(id string) error { //REVIEW: sent entries are removed, only the pending ones are kept for inspection
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if _, ok := ms.entries[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrEntryNotFound, id)
+	}
+	delete(ms.entries, id)
+	return nil
+}
+
+func (ms *MemoryStore) MarkFailed(id string, cause error) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	entry, ok := ms.entries[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrEntryNotFound, id)
+	}
+	ms.entries[id] = entry.failed(cause)
+	return nil
+}
+
+func (ms *MemoryStore) Quarantine(id string, cause error) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	entry, ok := ms.entries[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrEntryNotFound, id)
+	}
+	entry = entry.failed(cause)
+	entry.Quarantined = true
+	ms.quarantined[id] = entry
+	delete(ms.entries, id)
+	return nil
+}
+
+const quarantineDir = "quarantine"
+
+type FileStore struct { //REVIEW: one json file per entry, so the entries not published yet survive restarts and are published by the next relay
+	dir    string
+	mutex  sync.Mutex
+	notify chan struct{}
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, quarantineDir), 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir, notify: make(chan struct{}, 1)}, nil
+}
+
+func (fs *FileStore) path(id string, quarantined bool) (string, error) {
+	if _, err := uuid.Parse(id); err != nil { //REVIEW: ids come from callers, they must never escape the directory
+		return "", fmt.Errorf("%w: %s", ErrEntryNotFound, id)
+	}
+	if quarantined {
+		return filepath.Join(fs.dir, quarantineDir, id+".json"), nil
+	}
+	return filepath.Join(fs.dir, id+".json"), nil
+}
+
+func (fs *FileStore) write(entry Entry) error {
+	path, err := fs.path(entry.ID, entry.Quarantined)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(entry) //REVIEW: not indented, so the payload is stored byte for byte
+	if err != nil {
+		return err
+	}
+	temporary := path + ".tmp"
+	if err := os.WriteFile(temporary, content, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(temporary, path) //REVIEW: entries are never read half written
+}
+
+func (fs *FileStore) Add(entries ...Entry) error { //REVIEW: entries written before a failure are removed again, so events are stored all or none
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	for i, entry := range entries {
+		if err := fs.write(entry); err != nil {
+			for _, written := range entries[:i] {
+				_ = fs.remove(written.ID)
+			}
+			return err
+		}
+	}
+	notify(fs.notify)
+	return nil
+}
+
+func (fs *FileStore) Notifications() <-chan struct{} { //REVIEW: only signals the entries added through this store, entries written by other processes are seen on the next poll
+	return fs.notify
+}
+
+func (fs *FileStore) Pending(limit int) ([]Entry, error) {
+	return fs.list(false, limit)
+}
+
+func (fs *FileStore) Quarantined(limit int) ([]Entry, error) {
+	return fs.list(true, limit)
+}
+
+func (fs *FileStore) list(quarantined bool, limit int) ([]Entry, error) {
+	dir := fs.dir
+	if quarantined {
+		dir = filepath.Join(fs.dir, quarantineDir)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, file := range files {
+		id, ok := strings.CutSuffix(file.Name(), ".json")
+		if !ok || file.IsDir() {
+			continue
+		}
+		entry, err := fs.read(id, quarantined)
+		if errors.Is(err, ErrEntryNotFound) { //REVIEW: sent or quarantined while listing or not an entry
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return oldest(entries, limit), nil
+}
+
+func (fs *FileStore) Get(id string) (Entry, error) { //REVIEW: pending or quarantined entry
+	entry, err := fs.read(id, false)
+	if errors.Is(err, ErrEntryNotFound) {
+		return fs.read(id, true)
+	}
+	return entry, err
+}
+
+func (fs *FileStore) read(id string, quarantined bool) (entry Entry, err error) {
+	path, err := fs.path(id, quarantined)
+	if err != nil {
+		return
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entry, fmt.Errorf("%w: %s", ErrEntryNotFound, id)
+	}
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(content, &entry)
+	return
+}
+
+func (fs *FileStore) MarkSent(id string) error { //REVIEW: sent entries are removed, only the pending ones are kept for inspection
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	return fs.remove(id)
+}
+
+func (fs *FileStore) remove(id string) error {
+	path, err := fs.path(id, false)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrEntryNotFound, id)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (fs *FileStore) MarkFailed(id string, cause error) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	entry, err := fs.read(id, false)
+	if err != nil {
+		return err
+	}
+	return fs.write(entry.failed(cause))
+}
+
+func (fs *FileStore) Quarantine(id string, cause error) error { //REVIEW: the entry is written to the quarantine directory before it is removed, a crash in between leaves it in both and it is quarantined again by the next relay
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	entry, err := fs.read(id, false)
+	if err != nil {
+		return err
+	}
+	entry = entry.failed(cause)
+	entry.Quarantined = true
+	if err := fs.write(entry); err != nil {
+		return err
+	}
+	return fs.remove(id)
+}
+
+func (e Entry) failed(cause error) Entry {
+	now := time.Now().UTC()
+	e.Attempts++
+	e.LastError = cause.Error()
+	e.LastAttemptAt = &now
+	return e
+}
+
+func values(entries map[string]Entry) []Entry {
+	values := make([]Entry, 0, len(entries))
+	for _, entry := range entries {
+		values = append(values, entry)
+	}
+	return values
+}
+
+func oldest(entries []Entry, limit int) []Entry {
+	slices.SortFunc(entries, func(a, b Entry) int {
+		if order := a.CreatedAt.Compare(b.CreatedAt); order != 0 {
+			return order
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+func notify(notifications chan struct{}) {
+	select {
+	case notifications <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,264 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type OutboxTestSuite struct {
+	suite.Suite
+}
+
+func TestOutboxTestSuite(t *testing.T) {
+	suite.Run(t, new(OutboxTestSuite))
+}
+
+type event struct {
+	Value int `json:"value"`
+}
+
+type testProducer struct {
+	mutex sync.Mutex
+	sent  []event
+	fail  error
+}
+
+func (tp *testProducer) Send(e event) error {
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+	if tp.fail != nil {
+		return tp.fail
+	}
+	tp.sent = append(tp.sent, e)
+	return nil
+}
+
+type testHeadersProducer struct {
+	testProducer
+	headers []map[string]string
+}
+
+func (hp *testHeadersProducer) SendWithHeaders(e event, headers map[string]string) error {
+	hp.headers = append(hp.headers, headers)
+	return hp.Send(e)
+}
+
+func (tp *testProducer) events() []event {
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+	return append([]event(nil), tp.sent...)
+}
+
+func (suite *OutboxTestSuite) add(store Store, values ...int) []Entry {
+	entries := make([]Entry, 0, len(values))
+	for _, value := range values {
+		entry, err := NewEntry(event{Value: value}, nil)
+		suite.Require().NoError(err)
+		entries = append(entries, entry)
+		time.Sleep(time.Millisecond) //REVIEW: keeps the creation times apart so the order is deterministic
+	}
+	suite.Require().NoError(store.Add(entries...))
+	return entries
+}
+
+func (suite *OutboxTestSuite) TestRelay() {
+
+	logger := slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))
+
+	suite.Run("should publish pending entries in order and remove them", func() {
+		store := NewMemoryStore()
+		producer := &testProducer{}
+		suite.add(store, 1, 2, 3)
+
+		err := NewRelay[event](store, producer, WithBatchSize(2), WithLogger(logger)).Flush()
+		pending, _ := store.Pending(0)
+
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), []event{{1}, {2}, {3}}, producer.events())
+		assert.Empty(suite.T(), pending)
+	})
+	suite.Run("should keep entries the producer rejects pending for inspection", func() {
+		store := NewMemoryStore()
+		producer := &testProducer{fail: errors.New("broker unavailable")}
+		entries := suite.add(store, 1, 2)
+
+		err := NewRelay[event](store, producer, WithLogger(logger)).Flush()
+		stuck, _ := store.Get(entries[0].ID)
+		next, _ := store.Get(entries[1].ID)
+
+		assert.ErrorIs(suite.T(), err, producer.fail)
+		assert.Equal(suite.T(), 1, stuck.Attempts)
+		assert.Equal(suite.T(), "broker unavailable", stuck.LastError)
+		assert.NotNil(suite.T(), stuck.LastAttemptAt)
+		assert.Zero(suite.T(), next.Attempts, "entries after a rejected one must wait so events are not reordered")
+	})
+	suite.Run("should publish rejected entries once the producer recovers", func() {
+		store := NewMemoryStore()
+		producer := &testProducer{fail: errors.New("broker unavailable")}
+		suite.add(store, 1)
+		relay := NewRelay[event](store, producer, WithLogger(logger))
+		_ = relay.Flush()
+
+		producer.fail = nil
+		err := relay.Flush()
+
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), []event{{1}}, producer.events())
+	})
+	suite.Run("should send the headers of the entries when the producer supports them", func() {
+		store := NewMemoryStore()
+		producer := &testHeadersProducer{}
+		entry, _ := NewEntry(event{Value: 1}, map[string]string{"traceparent": "trace"})
+		store.Add(entry)
+
+		err := NewRelay[event](store, producer, WithLogger(logger)).Flush()
+
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), []event{{1}}, producer.events())
+		assert.Equal(suite.T(), []map[string]string{{"traceparent": "trace"}}, producer.headers)
+	})
+	suite.Run("should quarantine undecodable entries", func() {
+		store := NewMemoryStore()
+		producer := &testProducer{}
+		store.Add(Entry{ID: "invalid", Payload: []byte(`"text"`), CreatedAt: time.Now().Add(-time.Second)})
+		suite.add(store, 1)
+
+		err := NewRelay[event](store, producer, WithLogger(logger)).Flush()
+		invalid, getErr := store.Get("invalid")
+		pending, _ := store.Pending(0)
+
+		assert.NoError(suite.T(), err)
+		assert.NoError(suite.T(), getErr)
+		assert.Equal(suite.T(), 1, invalid.Attempts)
+		assert.True(suite.T(), invalid.Quarantined)
+		assert.Empty(suite.T(), pending)
+		assert.Equal(suite.T(), []event{{1}}, producer.events())
+	})
+	suite.Run("should publish entries behind more undecodable entries than a batch", func() {
+		store := NewMemoryStore()
+		producer := &testProducer{}
+		for i := range 3 {
+			store.Add(Entry{ID: uuid.NewString(), Payload: []byte(`"text"`), CreatedAt: time.Now().Add(time.Duration(i-10) * time.Second)})
+		}
+		suite.add(store, 1)
+
+		err := NewRelay[event](store, producer, WithBatchSize(2), WithLogger(logger)).Flush()
+		quarantined, _ := store.Quarantined(0)
+
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), []event{{1}}, producer.events())
+		assert.Len(suite.T(), quarantined, 3)
+	})
+	suite.Run("should publish new entries right away until the context is done", func() {
+		store := NewMemoryStore()
+		producer := &testProducer{}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			NewRelay[event](store, producer, WithInterval(time.Hour), WithLogger(logger)).Run(ctx)
+			close(done)
+		}()
+
+		suite.add(store, 1)
+		assert.Eventually(suite.T(), func() bool { return len(producer.events()) == 1 }, time.Second, time.Millisecond)
+
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			suite.Fail("relay did not stop")
+		}
+	})
+}
+
+func (suite *OutboxTestSuite) TestStores() {
+
+	stores := map[string]func() Store{
+		"memory": func() Store { return NewMemoryStore() },
+		"file": func() Store {
+			store, err := NewFileStore(suite.T().TempDir())
+			suite.Require().NoError(err)
+			return store
+		},
+	}
+	for name, newStore := range stores {
+		suite.Run(name+" store should report unknown entries", func() {
+			store := newStore()
+
+			_, err := store.Get(uuid.NewString())
+
+			assert.ErrorIs(suite.T(), err, ErrEntryNotFound)
+			assert.ErrorIs(suite.T(), store.MarkSent(uuid.NewString()), ErrEntryNotFound)
+			assert.ErrorIs(suite.T(), store.MarkFailed(uuid.NewString(), errors.New("failed")), ErrEntryNotFound)
+			assert.ErrorIs(suite.T(), store.Quarantine(uuid.NewString(), errors.New("failed")), ErrEntryNotFound)
+		})
+		suite.Run(name+" store should limit pending entries to the oldest ones", func() {
+			store := newStore()
+			entries := suite.add(store, 1, 2, 3)
+
+			pending, err := store.Pending(2)
+
+			assert.NoError(suite.T(), err)
+			assert.Equal(suite.T(), entries[:2], pending)
+		})
+		suite.Run(name+" store should record failures and remove sent entries", func() {
+			store := newStore()
+			entries := suite.add(store, 1, 2)
+
+			assert.NoError(suite.T(), store.MarkFailed(entries[0].ID, errors.New("broker unavailable")))
+			assert.NoError(suite.T(), store.MarkSent(entries[1].ID))
+			failed, err := store.Get(entries[0].ID)
+			pending, _ := store.Pending(0)
+
+			assert.NoError(suite.T(), err)
+			assert.Equal(suite.T(), 1, failed.Attempts)
+			assert.Equal(suite.T(), "broker unavailable", failed.LastError)
+			assert.Len(suite.T(), pending, 1)
+		})
+		suite.Run(name+" store should move quarantined entries out of the pending ones", func() {
+			store := newStore()
+			entries := suite.add(store, 1, 2)
+
+			assert.NoError(suite.T(), store.Quarantine(entries[0].ID, errors.New("undecodable")))
+			pending, _ := store.Pending(0)
+			quarantined, err := store.Quarantined(0)
+			entry, getErr := store.Get(entries[0].ID)
+
+			assert.NoError(suite.T(), err)
+			assert.Equal(suite.T(), entries[1:], pending)
+			suite.Require().Len(quarantined, 1)
+			assert.Equal(suite.T(), entry, quarantined[0])
+			assert.NoError(suite.T(), getErr)
+			assert.True(suite.T(), entry.Quarantined)
+			assert.Equal(suite.T(), "undecodable", entry.LastError)
+			assert.ErrorIs(suite.T(), store.MarkSent(entries[0].ID), ErrEntryNotFound, "quarantined entries are never published")
+		})
+	}
+	suite.Run("file store should keep pending entries across instances", func() {
+		dir := suite.T().TempDir()
+		store, _ := NewFileStore(dir)
+		entries := suite.add(store, 1)
+
+		reopened, err := NewFileStore(dir)
+		suite.Require().NoError(err)
+		pending, _ := reopened.Pending(0)
+
+		assert.Equal(suite.T(), entries, pending)
+	})
+	suite.Run("file store should reject ids escaping its directory", func() {
+		store, _ := NewFileStore(suite.T().TempDir())
+
+		_, err := store.Get("../outbox")
+
+		assert.ErrorIs(suite.T(), err, ErrEntryNotFound)
+	})
+}
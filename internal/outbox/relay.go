@@ -0,0 +1,119 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+type Producer[E any] interface {
+	Send(event E) error
+}
+
+type headersProducer[E any] interface {
+	SendWithHeaders(event E, headers map[string]string) error
+}
+
+type notifier interface {
+	Notifications() <-chan struct{}
+}
+
+type Relay[E any] struct { //REVIEW: publishes the pending entries in order, an entry is only marked sent once the producer accepted it so events are delivered at least once
+	store    Store
+	producer Producer[E]
+	config   relayConfig
+}
+
+type RelayOption func(*relayConfig) //REVIEW: provides with-builder methods to configure relays
+
+type relayConfig struct {
+	interval  time.Duration
+	batchSize int
+	logger    *slog.Logger
+}
+
+func WithInterval(interval time.Duration) RelayOption { //REVIEW: delay between polls of the store, stores notifying their writes are published right away
+	return func(rc *relayConfig) {
+		rc.interval = interval
+	}
+}
+func WithBatchSize(batchSize int) RelayOption { //REVIEW: entries read from the store at once
+	return func(rc *relayConfig) {
+		rc.batchSize = max(batchSize, 1)
+	}
+}
+func WithLogger(logger *slog.Logger) RelayOption {
+	return func(rc *relayConfig) {
+		rc.logger = logger
+	}
+}
+
+func NewRelay[E any](store Store, producer Producer[E], opts ...RelayOption) *Relay[E] {
+	config := relayConfig{interval: time.Second, batchSize: 100, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return &Relay[E]{store: store, producer: producer, config: config}
+}
+
+func (r *Relay[E]) Run(ctx context.Context) { //REVIEW: flushes the outbox until the context is done, failed entries are retried on the next poll
+	ticker := time.NewTicker(r.config.interval)
+	defer ticker.Stop()
+	var notifications <-chan struct{}
+	if n, ok := r.store.(notifier); ok {
+		notifications = n.Notifications()
+	}
+	for {
+		if err := r.Flush(); err != nil {
+			r.config.logger.Warn("error relaying outbox", slog.Any("error", err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-notifications:
+		}
+	}
+}
+
+func (r *Relay[E]) Flush() error { //REVIEW: publishes every pending entry, stopping at the first entry the producer rejects so events are not reordered
+	for {
+		entries, err := r.store.Pending(r.config.batchSize)
+		if err != nil {
+			return err
+		}
+		settled := 0 // published or quarantined, the entries that left the pending ones
+		for _, entry := range entries {
+			var event E
+			if err := json.Unmarshal(entry.Payload, &event); err != nil { //REVIEW: retrying will not fix an undecodable entry, it is quarantined for inspection so it does not hold back the next batches
+				r.config.logger.Error("quarantining undecodable outbox entry", slog.String("id", entry.ID), slog.Any("error", err))
+				if quarantineErr := r.store.Quarantine(entry.ID, err); quarantineErr != nil {
+					return quarantineErr
+				}
+				settled++
+				continue
+			}
+			if err := r.send(entry, event); err != nil {
+				if markErr := r.store.MarkFailed(entry.ID, err); markErr != nil {
+					return markErr
+				}
+				return err
+			}
+			if err := r.store.MarkSent(entry.ID); err != nil { //REVIEW: the event was already sent, it will be sent again on the next flush
+				return err
+			}
+			settled++
+		}
+		if settled == 0 || len(entries) < r.config.batchSize {
+			return nil
+		}
+	}
+}
+
+func (r *Relay[E]) send(entry Entry, event E) error {
+	if producer, ok := r.producer.(headersProducer[E]); ok && len(entry.Headers) > 0 {
+		return producer.SendWithHeaders(event, entry.Headers)
+	}
+	return r.producer.Send(event)
+}
@@ -9,9 +9,11 @@ const (
 	processed Status = "processed"
 )
 
+const RecordCreatedEventType = "record.created" //REVIEW: type of the events sent for created records, consumers route on it instead of on the go type name
+
 type Record struct {
 	Id     uuid.UUID `json:"id"`
-	Name   string    `json:"name"`
+	Name   string    `json:"name" redact:"response=true,log=mask"` //REVIEW: records may carry personal data, errors carrying them must not leak it
 	Status Status    `json:"status"`
 }
 
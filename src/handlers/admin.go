@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+func paginate[T any](c *fiber.Ctx, items []T) ([]T, error) { //REVIEW: the limit and offset queries page the listing, at most maxPageLimit items are returned at once
+	limit, offset := defaultPageLimit, 0
+	for name, value := range map[string]*int{"limit": &limit, "offset": &offset} {
+		if query := c.Query(name); query != "" {
+			parsed, err := strconv.Atoi(query)
+			if err != nil || parsed < 0 {
+				return nil, fiber.NewError(fiber.StatusBadRequest, "invalid "+name+": "+query)
+			}
+			*value = parsed
+		}
+	}
+	limit = min(limit, maxPageLimit)
+	offset = min(offset, len(items))
+	return items[offset:min(offset+limit, len(items))], nil
+}
+
+func withPayloads(c *fiber.Ctx) bool { //REVIEW: payloads may carry personal data, they are only written when explicitly asked for
+	return c.QueryBool("payload")
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/samber/lo"
+	"github.com/vfcoelho/go-project-pocs/internal"
+	errs "github.com/vfcoelho/go-project-pocs/internal/errors"
+	"github.com/vfcoelho/go-project-pocs/internal/events"
+)
+
+func deadLetterError(err error, id string) error {
+	if errors.Is(err, events.ErrDeadLetterNotFound) {
+		return errs.NewError(err, errs.WithCode(internal.DEAD_LETTER_NOT_FOUND_ERROR), errs.WithData(internal.DeadLetterIDData{ID: id}))
+	}
+	return err
+}
+
+func ListDeadLetters(c *fiber.Ctx, store events.DeadLetterStore) error {
+	letters, err := store.List()
+	if err != nil {
+		return err
+	}
+	if letters, err = paginate(c, letters); err != nil {
+		return err
+	}
+	if !withPayloads(c) {
+		letters = lo.Map(letters, func(letter events.DeadLetter, _ int) events.DeadLetter {
+			letter.Payload = nil
+			return letter
+		})
+	}
+	return c.JSON(letters)
+}
+
+func GetDeadLetter(c *fiber.Ctx, store events.DeadLetterStore) error {
+	letter, err := store.Get(c.Params("id"))
+	if err != nil {
+		return deadLetterError(err, c.Params("id"))
+	}
+	if !withPayloads(c) {
+		letter.Payload = nil
+	}
+	return c.JSON(letter)
+}
+
+func RedriveDeadLetter(c *fiber.Ctx, store events.DeadLetterStore, transport events.Transport) error {
+	if err := events.Redrive(store, transport, c.Params("id")); err != nil {
+		return deadLetterError(err, c.Params("id"))
+	}
+	return c.SendStatus(fiber.StatusAccepted)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/samber/lo"
+	"github.com/vfcoelho/go-project-pocs/internal"
+	errs "github.com/vfcoelho/go-project-pocs/internal/errors"
+	"github.com/vfcoelho/go-project-pocs/internal/outbox"
+)
+
+func ListOutbox(c *fiber.Ctx, store outbox.Store) error { //REVIEW: the older_than query lists only the entries stuck for longer than the given duration, the quarantined query lists the entries that will never be published instead of the pending ones
+	entries, err := lo.Ternary(c.QueryBool("quarantined"), store.Quarantined, store.Pending)(0)
+	if err != nil {
+		return err
+	}
+	if olderThan := c.Query("older_than"); olderThan != "" {
+		age, err := time.ParseDuration(olderThan)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid older_than duration: "+err.Error())
+		}
+		entries = lo.Filter(entries, func(entry outbox.Entry, _ int) bool {
+			return time.Since(entry.CreatedAt) >= age
+		})
+	}
+	if entries, err = paginate(c, entries); err != nil {
+		return err
+	}
+	if !withPayloads(c) {
+		entries = lo.Map(entries, func(entry outbox.Entry, _ int) outbox.Entry {
+			entry.Payload = nil
+			return entry
+		})
+	}
+	return c.JSON(entries)
+}
+
+func GetOutboxEntry(c *fiber.Ctx, store outbox.Store) error {
+	entry, err := store.Get(c.Params("id"))
+	if err != nil {
+		if errors.Is(err, outbox.ErrEntryNotFound) {
+			return errs.NewError(err, errs.WithCode(internal.OUTBOX_ENTRY_NOT_FOUND_ERROR), errs.WithData(internal.OutboxEntryIDData{ID: c.Params("id")}))
+		}
+		return err
+	}
+	if !withPayloads(c) {
+		entry.Payload = nil
+	}
+	return c.JSON(entry)
+}
@@ -18,8 +18,9 @@ type RecordRepository[T any] interface {
 	Update(record T) error
 }
 
-type EventProducer[T any] interface {
-	Send(event T) error
+type OutboxRepository[T any] interface {
+	RecordRepository[T]
+	AddWithEvents(record T, headers map[string]string, events ...any) error
 }
 
 func Get(c *fiber.Ctx, recordRepository RecordRepository[*dtos.Record]) error {
@@ -31,41 +32,38 @@ func Get(c *fiber.Ctx, recordRepository RecordRepository[*dtos.Record]) error {
 
 	record, err := recordRepository.Get(id)
 	if err != nil {
-		return errs.NewError(err, errs.WithCode(internal.RECORD_NOT_FOUND_ERROR), errs.WithData(struct {
-			ID uuid.UUID `json:"id"`
-		}{ID: id})) //REVIEW: the custom error can be used to return data to the caller
+		return errs.NewError(err, errs.WithCode(internal.RECORD_NOT_FOUND_ERROR), errs.WithData(internal.RecordIDData{ID: id})) //REVIEW: the custom error can be used to return data to the caller
 	}
 
 	return c.JSON(record)
 }
 
-func Post(c *fiber.Ctx, recordRepository RecordRepository[*dtos.Record], producer EventProducer[dtos.Record]) error {
+func Post(c *fiber.Ctx, recordRepository OutboxRepository[*dtos.Record]) error {
 
 	payload := dtos.NewRecord()
 	if err := c.BodyParser(payload); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, fmt.Errorf("error parsing payload: %w", err).Error()) //REVIEW: the ErrorRecoverMiddleware can handle fiber errors, that define an error code. Tough advised to use the error mapping instead, it can be useful for backward compatibility
 	}
 
-	if err := recordRepository.Add(payload); err != nil {
+	if err := recordRepository.AddWithEvents(payload, events.ContextHeaders(c.UserContext()), *payload); err != nil { //REVIEW: the event is stored with the record and published by the outbox relay, so it is neither lost when the producer fails nor sent for a record that was not stored
 		if errors.Is(err, errs.NewIsComparable(internal.RECORD_ALREADY_EXISTS_ERROR)) { //REVIEW: the custom error can be used to treat specific error codes that we might not want to return to the caller or cause the application to break loop
 			return fmt.Errorf("error adding record: %w", err) //REVIEW: the ErrorRecoverMiddleware can still identify the underlying error if it was wrapped.
 		}
 		return err
 	}
-	err := producer.Send(*payload)
-	if err != nil {
-		return err
-	}
 	return c.SendStatus(fiber.StatusCreated)
 }
 
 func Consume(c *events.ConsumerCtx, recordRepository RecordRepository[*dtos.Record]) error {
 
-	record := c.GetValue("message").(dtos.Record)
+	record, err := events.Message[dtos.Record](c)
+	if err != nil {
+		return err //REVIEW: the chain is missing ParseMessage[dtos.Record], no event can be processed without it
+	}
 	record.SetProcessed()
 
-	err := recordRepository.Update(&record)
-	err = errs.NewError(err, errs.WithData(record))
-
-	return err
+	if err := recordRepository.Update(&record); err != nil {
+		return errs.NewError(err, errs.WithData(record)) //REVIEW: the record fields tagged for redaction are redacted wherever the error is written
+	}
+	return nil //REVIEW: errs.NewError never returns nil, processed messages must return nil so the consumer acknowledges them instead of redelivering them
 }
@@ -2,12 +2,14 @@ package repositories
 
 import (
 	"errors"
-	"fmt"
+	"log/slog"
+	"sync"
 
 	"github.com/google/uuid"
 	"github.com/samber/lo"
 	internal "github.com/vfcoelho/go-project-pocs/internal"
 	errs "github.com/vfcoelho/go-project-pocs/internal/errors"
+	"github.com/vfcoelho/go-project-pocs/internal/outbox"
 )
 
 type RecordInterface interface {
@@ -20,16 +22,44 @@ var recordNotFound = errors.New("record not found")
 type Records[T RecordInterface] map[uuid.UUID]T
 
 type MemoryRepository[T RecordInterface] struct {
+	mutex   sync.RWMutex
 	records Records[T]
+	outbox  outbox.Store
+	logger  *slog.Logger
 }
 
-func NewMemoryRepository[T RecordInterface]() *MemoryRepository[T] {
+type MemoryRepositoryOption[T RecordInterface] func(*MemoryRepository[T])
+
+func WithLogger[T RecordInterface](logger *slog.Logger) MemoryRepositoryOption[T] {
+	return func(mr *MemoryRepository[T]) {
+		mr.logger = logger
+	}
+}
+
+func WithOutbox[T RecordInterface](store outbox.Store) MemoryRepositoryOption[T] { //REVIEW: store of the pending events, in memory by default
+	return func(mr *MemoryRepository[T]) {
+		mr.outbox = store
+	}
+}
+
+func NewMemoryRepository[T RecordInterface](opts ...MemoryRepositoryOption[T]) *MemoryRepository[T] {
 	result := new(MemoryRepository[T])
 	result.records = make(Records[T])
+	result.outbox = outbox.NewMemoryStore()
+	result.logger = slog.Default()
+	for _, opt := range opts {
+		opt(result)
+	}
 	return result
 }
 
+func (mr *MemoryRepository[T]) Outbox() outbox.Store { //REVIEW: pending events of the repository, published by an outbox relay
+	return mr.outbox
+}
+
 func (mr *MemoryRepository[T]) Get(id uuid.UUID) (record T, err error) {
+	mr.mutex.RLock()
+	defer mr.mutex.RUnlock()
 	record, ok := mr.records[id]
 	if !ok {
 		err = recordNotFound
@@ -38,6 +68,33 @@ func (mr *MemoryRepository[T]) Get(id uuid.UUID) (record T, err error) {
 }
 
 func (mr *MemoryRepository[T]) Add(record T) (err error) {
+	mr.mutex.Lock()
+	defer mr.mutex.Unlock()
+	return mr.add(record)
+}
+
+func (mr *MemoryRepository[T]) AddWithEvents(record T, headers map[string]string, events ...any) (err error) { //REVIEW: the record and its pending events are stored together, either both or none
+	entries := make([]outbox.Entry, 0, len(events))
+	for _, event := range events {
+		entry, err := outbox.NewEntry(event, headers)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	mr.mutex.Lock()
+	defer mr.mutex.Unlock()
+	if err = mr.add(record); err != nil {
+		return err
+	}
+	if err = mr.outbox.Add(entries...); err != nil {
+		delete(mr.records, record.ID())
+		return err
+	}
+	return
+}
+
+func (mr *MemoryRepository[T]) add(record T) (err error) {
 	if _, ok := mr.records[record.ID()]; ok {
 		return errs.NewError(errors.New("id already exists"), errs.WithCode(internal.RECORD_ALREADY_EXISTS_ERROR))
 	}
@@ -46,16 +103,18 @@ func (mr *MemoryRepository[T]) Add(record T) (err error) {
 	}
 	record.SetID(lo.Ternary(record.ID() == uuid.Nil, uuid.New(), record.ID()))
 	mr.records[record.ID()] = record
-	fmt.Printf("Record added: %v\n", record)
+	mr.logger.Info("record added", slog.Any("record", errs.Redact("", record, errs.TargetLog))) //REVIEW: records may carry personal data, they are logged through the same redaction policy as error data
 	return
 }
 
 func (mr *MemoryRepository[T]) Update(record T) (err error) {
+	mr.mutex.Lock()
+	defer mr.mutex.Unlock()
 	if _, ok := mr.records[record.ID()]; !ok {
 		return recordNotFound
 	}
 
 	mr.records[record.ID()] = record
-	fmt.Printf("Record updated: %v\n", record)
+	mr.logger.Info("record updated", slog.Any("record", errs.Redact("", record, errs.TargetLog)))
 	return
 }
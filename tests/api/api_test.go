@@ -2,29 +2,38 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
+	"log/slog"
 	nethttp "net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"github.com/vfcoelho/go-project-pocs/internal"
 	errs "github.com/vfcoelho/go-project-pocs/internal/errors"
 	"github.com/vfcoelho/go-project-pocs/internal/events"
 	"github.com/vfcoelho/go-project-pocs/internal/http"
+	"github.com/vfcoelho/go-project-pocs/internal/outbox"
 	"github.com/vfcoelho/go-project-pocs/src/dtos"
 )
 
 type ApiTestSuite struct {
 	suite.Suite
-	app *fiber.App
+	app       *fiber.App
+	transport *events.ChannelTransport
+	producer  *events.Producer[dtos.Record]
+	outbox    *outbox.MemoryStore
+	stopRelay func()
 }
 
-// TODO: add mocks for event producer
 func TestApiTestSuite(t *testing.T) {
 	suite.Run(t, new(ApiTestSuite))
 }
@@ -32,8 +41,30 @@ func TestApiTestSuite(t *testing.T) {
 func (suite *ApiTestSuite) SetupTest() {
 	suite.app = fiber.New()
 
-	producer := events.NewProducer[dtos.Record]()
-	http.SetupRouter(suite.app, producer)
+	suite.transport = events.NewChannelTransport(64)
+	producer, err := events.NewProducer[dtos.Record](events.WithProducerTransport(suite.transport), events.WithEventType(dtos.RecordCreatedEventType)) //REVIEW: the in-process transport replaces the netchan one, no port is bound by the tests
+	suite.Require().NoError(err)
+	suite.producer = producer
+	suite.outbox = outbox.NewMemoryStore()
+	suite.stopRelay = suite.runRelay(suite.outbox, suite.producer)
+	http.SetupRouter(suite.app, suite.outbox)
+}
+
+func (suite *ApiTestSuite) TearDownTest() {
+	suite.stopRelay()
+}
+
+func (suite *ApiTestSuite) runRelay(store outbox.Store, producer outbox.Producer[dtos.Record]) func() { //REVIEW: the relay is run by the caller of SetupRouter, as cmd/api does
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		outbox.NewRelay[dtos.Record](store, producer, outbox.WithInterval(time.Millisecond), outbox.WithLogger(slog.New(slog.NewJSONHandler(io.Discard, nil)))).Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
 }
 
 func (suite *ApiTestSuite) TestCreateRecord() {
@@ -69,8 +100,12 @@ func (suite *ApiTestSuite) TestCreateRecord() {
 			err := json.Unmarshal(bodyString, &body)
 			_ = err
 
+			assert.Equal(suite.T(), resp.Header.Get(http.HeaderCorrelationID), body.CorrelationID)
+			body.CorrelationID = "" // generated per request, only its presence on both the header and the body matters
+
 			assert.Equal(suite.T(), useCase.WantCode, resp.StatusCode)
 			assert.Equal(suite.T(), useCase.Want, body)
+			assert.NoError(suite.T(), internal.REGISTRY.Check(body.Error)) //REVIEW: every code returned by the API must be registered
 		}
 	}
 	TestCaseFiberResponse := func(name string, useCase testCase) (string, func()) {
@@ -92,7 +127,7 @@ func (suite *ApiTestSuite) TestCreateRecord() {
 		},
 		WantCode: 500,
 		Want: testResponse{
-			Error: errs.Error{Err: errors.New("id cannot be nil")},
+			Error: errs.Error{Err: errors.New("id cannot be nil"), Message: "Internal Server Error"},
 		},
 	}))
 	suite.Run(TestCaseFiberResponse("should fail while creating record with invalid id", testCase{
@@ -119,9 +154,621 @@ func (suite *ApiTestSuite) TestCreateRecord() {
 		WantCode: 409,
 		Want: testResponse{
 			Error: errs.Error{
-				Err:  errors.New("id already exists"),
-				Code: "record_already_exists",
+				Err:     errors.New("id already exists"),
+				Code:    "record.conflict.already_exists",
+				Message: "A record with the same id already exists",
 			},
 		},
 	}))
 }
+
+func (suite *ApiTestSuite) TestGetRecord() {
+
+	type testResponse struct {
+		errs.Error
+	}
+
+	const missingId = "0f6a0ba7-5f4b-4bb4-9d8e-3d52c1a1e6a1"
+
+	suite.Run("should fail with typed data while getting a missing record", func() {
+		req := httptest.NewRequest("GET", "/v1/record/"+missingId, nil)
+
+		resp, _ := suite.app.Test(req, -1)
+		bodyString, _ := io.ReadAll(resp.Body)
+		var body testResponse
+		err := json.Unmarshal(bodyString, &body)
+
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), 404, resp.StatusCode)
+		assert.Equal(suite.T(), internal.RecordIDData{ID: uuid.MustParse(missingId)}, body.Data)
+
+		assert.ErrorIs(suite.T(), body.Error, errs.NewIsComparable(internal.RECORD_ERROR))
+
+		data, ok := errs.DataAs[internal.RecordIDData](body.Error)
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), uuid.MustParse(missingId), data.ID)
+	})
+}
+
+func (suite *ApiTestSuite) TestProblemDetails() {
+
+	const existingId = "5d2ca371-f623-4aac-abb0-ddc31f44d002"
+	const missingId = "0f6a0ba7-5f4b-4bb4-9d8e-3d52c1a1e6a1"
+
+	type testCase struct {
+		Method   string
+		Route    string
+		Payload  string
+		Accept   string
+		WantCode int
+		WantType string
+		Want     map[string]any
+	}
+
+	TestCase := func(name string, useCase testCase) (string, func()) {
+		return name, func() {
+			req := httptest.NewRequest(useCase.Method, useCase.Route, bytes.NewBufferString(useCase.Payload))
+			req.Header.Add("Content-Type", "application/json")
+			req.Header.Add("Accept", useCase.Accept)
+
+			resp, _ := suite.app.Test(req, -1)
+			bodyString, _ := io.ReadAll(resp.Body)
+			var body map[string]any
+			err := json.Unmarshal(bodyString, &body)
+			_ = err
+
+			assert.Equal(suite.T(), resp.Header.Get(http.HeaderCorrelationID), body["correlation_id"])
+			delete(body, "correlation_id")
+
+			assert.Equal(suite.T(), useCase.WantCode, resp.StatusCode)
+			assert.Equal(suite.T(), useCase.WantType, resp.Header.Get("Content-Type"))
+			assert.Equal(suite.T(), useCase.Want, body)
+		}
+	}
+
+	setup := httptest.NewRequest("POST", "/v1/record", bytes.NewBufferString(`{"id":"`+existingId+`","name":"Dummy Record"}`))
+	setup.Header.Add("Content-Type", "application/json")
+	_, _ = suite.app.Test(setup, -1)
+
+	suite.Run(TestCase("should render raw errors as problem details", testCase{
+		Method:   "POST",
+		Route:    "/v1/record",
+		Payload:  `{"id":"` + uuid.Nil.String() + `","name":"Dummy Record"}`,
+		Accept:   http.MIMEApplicationProblemJSON,
+		WantCode: 500,
+		WantType: http.MIMEApplicationProblemJSON,
+		Want: map[string]any{
+			"type":     "about:blank",
+			"title":    "Internal Server Error",
+			"status":   float64(500),
+			"instance": "/v1/record",
+		},
+	}))
+	suite.Run(TestCase("should render custom errors as problem details", testCase{
+		Method:   "POST",
+		Route:    "/v1/record",
+		Payload:  `{"id":"` + existingId + `","name":"Dummy Record"}`,
+		Accept:   http.MIMEApplicationProblemJSON + ", application/json;q=0.5",
+		WantCode: 409,
+		WantType: http.MIMEApplicationProblemJSON,
+		Want: map[string]any{
+			"type":     "urn:go-project-pocs:error:record.conflict.already_exists",
+			"title":    "A record with the same id already exists",
+			"status":   float64(409),
+			"instance": "/v1/record",
+			"code":     "record.conflict.already_exists",
+		},
+	}))
+	suite.Run(TestCase("should render custom error data as problem details extension members", testCase{
+		Method:   "GET",
+		Route:    "/v1/record/" + missingId,
+		Accept:   http.MIMEApplicationProblemJSON,
+		WantCode: 404,
+		WantType: http.MIMEApplicationProblemJSON,
+		Want: map[string]any{
+			"type":     "urn:go-project-pocs:error:record.not_found",
+			"title":    "record not found",
+			"status":   float64(404),
+			"detail":   "Record " + missingId + " was not found",
+			"instance": "/v1/record/" + missingId,
+			"code":     "record.not_found",
+			"id":       missingId,
+		},
+	}))
+	suite.Run(TestCase("should render fiber errors as problem details", testCase{
+		Method:   "POST",
+		Route:    "/v1/record",
+		Payload:  `{"id":`,
+		Accept:   http.MIMEApplicationProblemJSON,
+		WantCode: 400,
+		WantType: http.MIMEApplicationProblemJSON,
+		Want: map[string]any{
+			"type":     "about:blank",
+			"title":    "Bad Request",
+			"status":   float64(400),
+			"detail":   "error parsing payload: unexpected end of JSON input",
+			"instance": "/v1/record",
+		},
+	}))
+	suite.Run(TestCase("should keep the legacy format for clients not asking for problem details", testCase{
+		Method:   "GET",
+		Route:    "/v1/record/" + missingId,
+		Accept:   "*/*",
+		WantCode: 404,
+		WantType: fiber.MIMEApplicationJSON,
+		Want: map[string]any{
+			"error":   "record not found",
+			"code":    "record.not_found",
+			"data":    map[string]any{"id": missingId},
+			"message": "Record " + missingId + " was not found",
+		},
+	}))
+	suite.Run("should not let error data overwrite reserved members", func() {
+		err := errs.NewError(errors.New("test error"), errs.WithCode("test"), errs.WithCorrelationID("test-correlation-id"), errs.WithData(map[string]any{"code": "other", "status": 200, "extra": "value"}))
+		problem := http.NewProblem(err, "", 500, "urn:test:", "/test")
+		assert.Equal(suite.T(), errs.ErrorCode("test"), problem.Extensions["code"])
+		assert.Equal(suite.T(), "test-correlation-id", problem.Extensions["correlation_id"])
+		assert.Equal(suite.T(), "value", problem.Extensions["extra"])
+		assert.NotContains(suite.T(), problem.Extensions, "status")
+		assert.Equal(suite.T(), "Internal Server Error", problem.Title)
+		assert.Empty(suite.T(), problem.Detail, "the internal cause is never exposed")
+	})
+}
+
+func (suite *ApiTestSuite) TestProductionMode() {
+
+	type testResponse struct {
+		errs.Error
+	}
+
+	app := fiber.New()
+	http.SetupRouter(app, suite.outbox, http.WithProductionMode())
+	app.Get("/namespaced", func(c *fiber.Ctx) error {
+		return errs.NewError(errors.New("internal details"), errs.WithCode(internal.RECORD_ERROR+".unknown"))
+	})
+
+	request := func(method string, route string, payload string, correlationID string) (*nethttp.Response, testResponse) {
+		req := httptest.NewRequest(method, route, bytes.NewBufferString(payload))
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add(http.HeaderCorrelationID, correlationID)
+
+		resp, _ := app.Test(req, -1)
+		bodyString, _ := io.ReadAll(resp.Body)
+		var body testResponse
+		err := json.Unmarshal(bodyString, &body)
+		_ = err
+		return resp, body
+	}
+
+	suite.Run("should hide internal causes of unmapped errors", func() {
+		resp, body := request("POST", "/v1/record", `{"id":"`+uuid.Nil.String()+`","name":"Dummy Record"}`, "")
+
+		assert.Equal(suite.T(), 500, resp.StatusCode)
+		assert.NotEmpty(suite.T(), body.CorrelationID)
+		assert.Equal(suite.T(), resp.Header.Get(http.HeaderCorrelationID), body.CorrelationID)
+		assert.Equal(suite.T(), "Internal Server Error", body.Message)
+		assert.Empty(suite.T(), body.Err.Error())
+	})
+	suite.Run("should hide internal causes of codes only resolving to a namespace without status", func() {
+		resp, body := request("GET", "/namespaced", "", "")
+
+		assert.Equal(suite.T(), 500, resp.StatusCode)
+		assert.Equal(suite.T(), internal.RECORD_ERROR+".unknown", body.Code)
+		assert.Empty(suite.T(), body.Err.Error())
+	})
+	suite.Run("should keep mapped errors and the caller id as the request id", func() {
+		id := uuid.NewString()
+		resp, body := request("GET", "/v1/record/"+id, "", "caller-correlation-id")
+
+		assert.Equal(suite.T(), 404, resp.StatusCode)
+		assert.NotEqual(suite.T(), "caller-correlation-id", body.CorrelationID)
+		assert.Equal(suite.T(), resp.Header.Get(http.HeaderCorrelationID), body.CorrelationID)
+		assert.Equal(suite.T(), "caller-correlation-id", body.RequestID)
+		assert.Equal(suite.T(), "Record "+id+" was not found", body.Message)
+		assert.Equal(suite.T(), "record not found", body.Err.Error())
+	})
+	suite.Run("should drop invalid caller ids", func() {
+		resp, body := request("GET", "/v1/record/"+uuid.NewString(), "", "<script>alert(1)</script>")
+
+		assert.Equal(suite.T(), 404, resp.StatusCode)
+		assert.NotEmpty(suite.T(), body.CorrelationID)
+		assert.Empty(suite.T(), body.RequestID)
+
+		resp, body = request("GET", "/v1/record/"+uuid.NewString(), "", strings.Repeat("a", 129))
+		assert.Equal(suite.T(), 404, resp.StatusCode)
+		assert.Empty(suite.T(), body.RequestID)
+	})
+}
+
+func (suite *ApiTestSuite) TestLocalizedMessages() {
+
+	const missingId = "0f6a0ba7-5f4b-4bb4-9d8e-3d52c1a1e6a1"
+
+	type testCase struct {
+		AcceptLanguage string
+		WantLanguage   string
+		WantMessage    string
+	}
+
+	TestCase := func(name string, useCase testCase) (string, func()) {
+		return name, func() {
+			req := httptest.NewRequest("GET", "/v1/record/"+missingId, nil)
+			req.Header.Add("Accept-Language", useCase.AcceptLanguage)
+
+			resp, _ := suite.app.Test(req, -1)
+			bodyString, _ := io.ReadAll(resp.Body)
+			var body errs.Error
+			err := json.Unmarshal(bodyString, &body)
+			_ = err
+
+			assert.Equal(suite.T(), 404, resp.StatusCode)
+			assert.Equal(suite.T(), useCase.WantLanguage, resp.Header.Get("Content-Language"))
+			assert.Equal(suite.T(), useCase.WantMessage, body.Message)
+		}
+	}
+
+	suite.Run(TestCase("should localize messages for an exact locale", testCase{
+		AcceptLanguage: "pt-BR",
+		WantLanguage:   "pt-BR",
+		WantMessage:    "O registro " + missingId + " não foi encontrado",
+	}))
+	suite.Run(TestCase("should localize messages for the base language of a locale", testCase{
+		AcceptLanguage: "fr;q=0.9, es-AR;q=0.8, en;q=0.1",
+		WantLanguage:   "es",
+		WantMessage:    "No se encontró el registro " + missingId,
+	}))
+	suite.Run(TestCase("should fall back to the default locale", testCase{
+		AcceptLanguage: "fr",
+		WantLanguage:   "en",
+		WantMessage:    "Record " + missingId + " was not found",
+	}))
+	suite.Run("should localize problem titles and keep messages with placeholders as their detail", func() {
+		problem := func(method string, route string, payload string) map[string]any {
+			req := httptest.NewRequest(method, route, bytes.NewBufferString(payload))
+			req.Header.Add("Content-Type", "application/json")
+			req.Header.Add("Accept", http.MIMEApplicationProblemJSON)
+			req.Header.Add("Accept-Language", "pt-BR")
+			resp, _ := suite.app.Test(req, -1)
+			var body map[string]any
+			_ = json.NewDecoder(resp.Body).Decode(&body)
+			assert.Equal(suite.T(), "pt-BR", resp.Header.Get("Content-Language"))
+			return body
+		}
+		payload := `{"id":"` + uuid.NewString() + `","name":"Dummy Record"}`
+		setup := httptest.NewRequest("POST", "/v1/record", bytes.NewBufferString(payload))
+		setup.Header.Add("Content-Type", "application/json")
+		_, _ = suite.app.Test(setup, -1)
+
+		body := problem("POST", "/v1/record", payload)
+		assert.Equal(suite.T(), "Já existe um registro com o mesmo id", body["title"])
+		assert.NotContains(suite.T(), body, "detail")
+
+		body = problem("GET", "/v1/record/"+missingId, "")
+		assert.Equal(suite.T(), "record not found", body["title"])
+		assert.Equal(suite.T(), "O registro "+missingId+" não foi encontrado", body["detail"])
+	})
+}
+
+func (suite *ApiTestSuite) TestErrorLogging() {
+
+	var buffer bytes.Buffer
+	app := fiber.New()
+	http.SetupRouter(app, suite.outbox, http.WithLogger(slog.New(slog.NewJSONHandler(&buffer, nil))))
+
+	suite.Run("should log errors with the code severity the correlation id and the request id", func() {
+		req := httptest.NewRequest("GET", "/v1/record/"+uuid.NewString(), nil)
+		req.Header.Add(http.HeaderCorrelationID, "caller-correlation-id")
+
+		resp, _ := app.Test(req, -1)
+		var logged map[string]any
+		err := json.Unmarshal(buffer.Bytes(), &logged)
+
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), 404, resp.StatusCode)
+		assert.Equal(suite.T(), "WARN", logged["level"])
+		assert.Equal(suite.T(), resp.Header.Get(http.HeaderCorrelationID), logged["correlation_id"])
+		assert.Equal(suite.T(), "caller-correlation-id", logged["error"].(map[string]any)["request_id"])
+		assert.Equal(suite.T(), "record.not_found", logged["error"].(map[string]any)["code"])
+	})
+	suite.Run("should log added records with their redacted fields masked", func() {
+		buffer.Reset()
+		body, _ := json.Marshal(map[string]string{"id": uuid.NewString(), "name": "John Smith"})
+		req := httptest.NewRequest("POST", "/v1/record", bytes.NewReader(body))
+		req.Header.Add("Content-Type", "application/json")
+
+		resp, _ := app.Test(req, -1)
+
+		assert.Equal(suite.T(), 201, resp.StatusCode)
+		assert.Contains(suite.T(), buffer.String(), `"record added"`)
+		assert.Contains(suite.T(), buffer.String(), "mith")
+		assert.NotContains(suite.T(), buffer.String(), "John Smith")
+	})
+}
+
+func (suite *ApiTestSuite) TestRetryableErrors() {
+
+	app := fiber.New()
+	app.Use(http.ErrorRecoverMiddleware)
+	app.Get("/throttled", func(c *fiber.Ctx) error {
+		return errs.NewError(errors.New("too many requests"), errs.WithClass(errs.ClassThrottled), errs.WithRetryAfter(1500*time.Millisecond))
+	})
+	app.Get("/transient", func(c *fiber.Ctx) error {
+		return errs.NewError(errors.New("database unavailable"), errs.WithClass(errs.ClassTransient))
+	})
+
+	type testCase struct {
+		Route          string
+		WantCode       int
+		WantRetryAfter string
+	}
+
+	TestCase := func(name string, useCase testCase) (string, func()) {
+		return name, func() {
+			resp, _ := app.Test(httptest.NewRequest("GET", useCase.Route, nil), -1)
+
+			assert.Equal(suite.T(), useCase.WantCode, resp.StatusCode)
+			assert.Equal(suite.T(), useCase.WantRetryAfter, resp.Header.Get("Retry-After"))
+		}
+	}
+
+	suite.Run(TestCase("should respond throttled errors with their retry delay", testCase{
+		Route:          "/throttled",
+		WantCode:       429,
+		WantRetryAfter: "2",
+	}))
+	suite.Run(TestCase("should respond transient errors as unavailable", testCase{
+		Route:          "/transient",
+		WantCode:       503,
+		WantRetryAfter: "",
+	}))
+}
+
+func (suite *ApiTestSuite) TestErrorMetrics() {
+
+	metrics := errs.NewMetrics()
+	app := fiber.New()
+	http.SetupRouter(app, suite.outbox, http.WithMetrics(metrics), http.WithMetricsEndpoint())
+
+	suite.Run("should count errors per code and route and expose them to prometheus", func() {
+		for range 2 {
+			_, _ = app.Test(httptest.NewRequest("GET", "/v1/record/"+uuid.NewString(), nil), -1)
+		}
+		_, _ = app.Test(httptest.NewRequest("GET", "/v1/record/invalid", nil), -1)
+
+		resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+		body, _ := io.ReadAll(resp.Body)
+
+		assert.Equal(suite.T(), 200, resp.StatusCode)
+		assert.Equal(suite.T(), errs.PrometheusContentType, resp.Header.Get("Content-Type"))
+		assert.Equal(suite.T(), uint64(2), metrics.Count(internal.RECORD_NOT_FOUND_ERROR))
+		assert.Regexp(suite.T(), `errors_total\{code="record.not_found",transport="http",route="GET /v1/record/:id",fingerprint="[0-9a-f]{16}"\} 2`, string(body))
+		assert.Regexp(suite.T(), `errors_total\{code="",transport="http",route="GET /v1/record/:id",fingerprint="[0-9a-f]{16}"\} 1`, string(body))
+		assert.Regexp(suite.T(), `error_fingerprint_info\{fingerprint="[0-9a-f]{16}",code="record.not_found",call_site="[0-9a-f]{16}"\} 1`, string(body))
+		assert.NotContains(suite.T(), string(body), "src/handlers")
+	})
+	suite.Run("should not expose the metrics unless the endpoint is enabled", func() {
+		app := fiber.New()
+		http.SetupRouter(app, suite.outbox, http.WithMetrics(metrics))
+
+		resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+
+		assert.Equal(suite.T(), 404, resp.StatusCode)
+	})
+}
+
+func (suite *ApiTestSuite) TestRecordEvents() {
+
+	suite.Run("should publish created records", func() {
+		id := uuid.New()
+		payload, _ := json.Marshal(map[string]string{"id": id.String(), "name": "test"})
+		req := httptest.NewRequest("POST", "/v1/record", bytes.NewReader(payload))
+		req.Header.Add("Content-Type", "application/json")
+
+		resp, _ := suite.app.Test(req, -1)
+		delivery, err := suite.transport.Receive(context.Background())
+		suite.Require().NoError(err)
+		envelope, ok := events.ParseEnvelope(delivery.Message)
+		var record dtos.Record
+		_ = json.Unmarshal(envelope.Payload, &record)
+
+		assert.Equal(suite.T(), 201, resp.StatusCode)
+		assert.True(suite.T(), ok)
+		assert.Equal(suite.T(), dtos.RecordCreatedEventType, envelope.Type)
+		assert.Equal(suite.T(), events.DefaultSource, envelope.Source)
+		assert.Equal(suite.T(), id, record.ID())
+	})
+	suite.Run("should propagate the trace context of the request", func() {
+		payload, _ := json.Marshal(map[string]string{"id": uuid.NewString(), "name": "test"})
+		req := httptest.NewRequest("POST", "/v1/record", bytes.NewReader(payload))
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+		_, _ = suite.app.Test(req, -1)
+		delivery, err := suite.transport.Receive(context.Background())
+		suite.Require().NoError(err)
+		envelope, _ := events.ParseEnvelope(delivery.Message)
+
+		assert.Equal(suite.T(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", envelope.Header(events.HeaderTraceParent))
+	})
+	suite.Run("should propagate the request id to the consumer as the correlation id", func() {
+		payload, _ := json.Marshal(map[string]string{"id": uuid.NewString(), "name": "test"})
+		req := httptest.NewRequest("POST", "/v1/record", bytes.NewReader(payload))
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add(http.HeaderRequestID, "caller-request-id")
+
+		_, _ = suite.app.Test(req, -1)
+		consumer, err := events.NewConsumer(events.WithConsumerTransport(suite.transport))
+		suite.Require().NoError(err)
+		received := make(chan [2]string, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			_ = consumer.Consume(ctx, func(cc *events.ConsumerCtx) error {
+				id, _ := events.CorrelationIDFrom(cc.Context())
+				received <- [2]string{cc.Header(events.HeaderCorrelationID), id}
+				return nil
+			})
+		}()
+
+		select {
+		case ids := <-received:
+			assert.Equal(suite.T(), [2]string{"caller-request-id", "caller-request-id"}, ids, "the envelope header and the consumer context carry the id")
+		case <-time.After(5 * time.Second):
+			suite.Fail("event not consumed")
+		}
+	})
+}
+
+func (suite *ApiTestSuite) TestDeadLetters() {
+
+	store := events.NewMemoryDeadLetterStore()
+	app, admin := fiber.New(), fiber.New()
+	http.SetupRouter(app, suite.outbox, http.WithAdminRouter(admin), http.WithDeadLetters(store, suite.transport))
+	letter := events.NewDeadLetter(&events.Delivery{Message: []byte(`{"id": "1"}`), Attempt: 1}, "handler", 3, errors.New("failed"))
+	_ = store.Add(letter)
+
+	suite.Run("should only expose dead letters on the admin router", func() {
+		resp, _ := app.Test(httptest.NewRequest("GET", "/v1/deadletters", nil), -1)
+		assert.Equal(suite.T(), 404, resp.StatusCode)
+
+		resp, _ = app.Test(httptest.NewRequest("POST", "/v1/deadletters/"+letter.ID+"/redrive", nil), -1)
+		assert.Equal(suite.T(), 404, resp.StatusCode)
+	})
+	suite.Run("should list and inspect dead letters without their payloads unless asked for", func() {
+		resp, _ := admin.Test(httptest.NewRequest("GET", "/v1/deadletters", nil), -1)
+		var letters []events.DeadLetter
+		_ = json.NewDecoder(resp.Body).Decode(&letters)
+		assert.Equal(suite.T(), 200, resp.StatusCode)
+		suite.Require().Len(letters, 1)
+		assert.Nil(suite.T(), letters[0].Payload)
+
+		resp, _ = admin.Test(httptest.NewRequest("GET", "/v1/deadletters/"+letter.ID, nil), -1)
+		var inspected events.DeadLetter
+		_ = json.NewDecoder(resp.Body).Decode(&inspected)
+		assert.Equal(suite.T(), 200, resp.StatusCode)
+		assert.Nil(suite.T(), inspected.Payload)
+		assert.Equal(suite.T(), 3, inspected.Attempts)
+
+		resp, _ = admin.Test(httptest.NewRequest("GET", "/v1/deadletters/"+letter.ID+"?payload=true", nil), -1)
+		_ = json.NewDecoder(resp.Body).Decode(&inspected)
+		assert.Equal(suite.T(), letter.Payload, inspected.Payload)
+	})
+	suite.Run("should page the dead letters", func() {
+		list := func(query string) (int, []events.DeadLetter) {
+			resp, _ := admin.Test(httptest.NewRequest("GET", "/v1/deadletters"+query, nil), -1)
+			var letters []events.DeadLetter
+			_ = json.NewDecoder(resp.Body).Decode(&letters)
+			return resp.StatusCode, letters
+		}
+		second := events.NewDeadLetter(&events.Delivery{Message: []byte(`{"id": "2"}`), Attempt: 1}, "handler", 1, errors.New("failed"))
+		second.FailedAt = letter.FailedAt.Add(time.Second)
+		_ = store.Add(second)
+		defer store.Remove(second.ID)
+
+		_, letters := list("?limit=1")
+		suite.Require().Len(letters, 1)
+		assert.Equal(suite.T(), letter.ID, letters[0].ID)
+		_, letters = list("?limit=1&offset=1")
+		suite.Require().Len(letters, 1)
+		assert.Equal(suite.T(), second.ID, letters[0].ID)
+		_, letters = list("?offset=5")
+		assert.Empty(suite.T(), letters)
+		status, _ := list("?limit=-1")
+		assert.Equal(suite.T(), 400, status)
+	})
+	suite.Run("should re-drive dead letters to the main queue", func() {
+		resp, _ := admin.Test(httptest.NewRequest("POST", "/v1/deadletters/"+letter.ID+"/redrive", nil), -1)
+		delivery, err := suite.transport.Receive(context.Background())
+		suite.Require().NoError(err)
+
+		assert.Equal(suite.T(), 202, resp.StatusCode)
+		assert.Equal(suite.T(), []byte(`{"id": "1"}`), delivery.Message)
+
+		resp, _ = admin.Test(httptest.NewRequest("POST", "/v1/deadletters/"+letter.ID+"/redrive", nil), -1)
+		var body errs.Error
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		assert.Equal(suite.T(), 404, resp.StatusCode)
+		assert.Equal(suite.T(), internal.DEAD_LETTER_NOT_FOUND_ERROR, body.Code)
+	})
+}
+
+type failingProducer struct{}
+
+func (failingProducer) Send(dtos.Record) error {
+	return errors.New("broker unavailable")
+}
+
+func (suite *ApiTestSuite) TestOutbox() {
+
+	store := outbox.NewMemoryStore()
+	defer suite.runRelay(store, failingProducer{})()
+	app, admin := fiber.New(), fiber.New()
+	http.SetupRouter(app, store, http.WithAdminRouter(admin), http.WithLogger(slog.New(slog.NewJSONHandler(io.Discard, nil))))
+
+	id := uuid.New()
+	payload, _ := json.Marshal(map[string]string{"id": id.String(), "name": "test"})
+	req := httptest.NewRequest("POST", "/v1/record", bytes.NewReader(payload))
+	req.Header.Add("Content-Type", "application/json")
+	resp, _ := app.Test(req, -1)
+	suite.Require().Equal(201, resp.StatusCode, "the record is stored even when the event cannot be published yet")
+
+	listOutbox := func(query string) []outbox.Entry {
+		resp, _ := admin.Test(httptest.NewRequest("GET", "/v1/outbox"+query, nil), -1)
+		var entries []outbox.Entry
+		_ = json.NewDecoder(resp.Body).Decode(&entries)
+		return entries
+	}
+
+	suite.Run("should only expose the outbox on the admin router", func() {
+		resp, _ := app.Test(httptest.NewRequest("GET", "/v1/outbox", nil), -1)
+		assert.Equal(suite.T(), 404, resp.StatusCode)
+	})
+	suite.Run("should list the stuck entries with their last error", func() {
+		assert.Eventually(suite.T(), func() bool {
+			entries := listOutbox("")
+			return len(entries) == 1 && entries[0].Attempts > 0
+		}, time.Second, time.Millisecond)
+
+		entries := listOutbox("?older_than=1ms")
+		suite.Require().Len(entries, 1)
+		assert.Equal(suite.T(), "broker unavailable", entries[0].LastError)
+		assert.Nil(suite.T(), entries[0].Payload, "payloads are only listed when asked for")
+		assert.Empty(suite.T(), listOutbox("?older_than=1h"))
+		assert.Empty(suite.T(), listOutbox("?offset=1"))
+
+		resp, _ := admin.Test(httptest.NewRequest("GET", "/v1/outbox/"+entries[0].ID+"?payload=true", nil), -1)
+		var entry outbox.Entry
+		_ = json.NewDecoder(resp.Body).Decode(&entry)
+		assert.Equal(suite.T(), 200, resp.StatusCode)
+		assert.Equal(suite.T(), entries[0].ID, entry.ID)
+		var record dtos.Record
+		_ = json.Unmarshal(entry.Payload, &record)
+		assert.Equal(suite.T(), id, record.ID())
+	})
+	suite.Run("should list quarantined entries apart from the pending ones", func() {
+		quarantined := outbox.Entry{ID: uuid.NewString(), Payload: []byte(`"text"`), CreatedAt: time.Now()}
+		suite.Require().NoError(store.Add(quarantined))
+		suite.Require().NoError(store.Quarantine(quarantined.ID, errors.New("undecodable")))
+
+		entries := listOutbox("?quarantined=true")
+		suite.Require().Len(entries, 1)
+		assert.Equal(suite.T(), quarantined.ID, entries[0].ID)
+		assert.True(suite.T(), entries[0].Quarantined)
+		pending := listOutbox("")
+		suite.Require().Len(pending, 1)
+		assert.NotEqual(suite.T(), quarantined.ID, pending[0].ID)
+	})
+	suite.Run("should reject invalid durations and unknown entries", func() {
+		resp, _ := admin.Test(httptest.NewRequest("GET", "/v1/outbox?older_than=soon", nil), -1)
+		assert.Equal(suite.T(), 400, resp.StatusCode)
+
+		resp, _ = admin.Test(httptest.NewRequest("GET", "/v1/outbox?limit=many", nil), -1)
+		assert.Equal(suite.T(), 400, resp.StatusCode)
+
+		resp, _ = admin.Test(httptest.NewRequest("GET", "/v1/outbox/unknown", nil), -1)
+		var body errs.Error
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		assert.Equal(suite.T(), 404, resp.StatusCode)
+		assert.Equal(suite.T(), internal.OUTBOX_ENTRY_NOT_FOUND_ERROR, body.Code)
+	})
+}